@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"github.com/cfwidget/cfwidget/curseforge"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/spf13/cast"
-	"go.elastic.co/apm/v2"
 	"log"
 	"regexp"
 	"strings"
@@ -53,7 +53,7 @@ func (consumer *AddProjectConsumer) Consume(url string, ctx context.Context) *ui
 }
 
 func resolveSlug(path string, c context.Context) (uint, error) {
-	span, ctx := apm.StartSpan(c, "resolveSlug", "custom")
+	span, ctx := tracing.StartSpan(c, "resolveSlug", "custom")
 	defer span.End()
 
 	var err error
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ScopeSync allows forcing a project to sync with CurseForge
+	ScopeSync = "sync"
+	// ScopeCache allows purging responses from the cache
+	ScopeCache = "cache"
+	// ScopeKeys allows creating, listing and revoking API keys
+	ScopeKeys = "keys"
+	// ScopeMetrics allows reading the Prometheus metrics
+	ScopeMetrics = "metrics"
+	// ScopeAll allows everything, including scopes added later
+	ScopeAll = "*"
+)
+
+// adminScopes are the scopes a token can be given
+var adminScopes = []string{ScopeSync, ScopeCache, ScopeKeys, ScopeMetrics, ScopeAll}
+
+type adminToken struct {
+	hash   [sha256.Size]byte
+	scopes []string
+}
+
+// getAdminTokens reads ADMIN_TOKENS, which is a comma or newline separated list of token:scope|scope entries.
+// Entries without scopes are ignored, so a token can't be given everything by accident, while scopes which don't
+// exist are an error, as the token would otherwise quietly not have them.
+func getAdminTokens() ([]adminToken, error) {
+	tokens := make([]adminToken, 0)
+	for _, entry := range strings.FieldsFunc(env.Get("ADMIN_TOKENS"), func(r rune) bool { return r == ',' || r == '\n' }) {
+		token, scopes, found := strings.Cut(strings.TrimSpace(entry), ":")
+		token, scopes = strings.TrimSpace(token), strings.TrimSpace(scopes)
+		if !found || token == "" || scopes == "" {
+			continue
+		}
+
+		parsed := make([]string, 0)
+		for _, scope := range strings.Split(scopes, "|") {
+			scope = strings.TrimSpace(scope)
+			if !contains(scope, adminScopes) {
+				return nil, fmt.Errorf("unknown admin token scope %q", scope)
+			}
+			parsed = append(parsed, scope)
+		}
+
+		tokens = append(tokens, adminToken{
+			hash:   sha256.Sum256([]byte(token)),
+			scopes: parsed,
+		})
+	}
+	return tokens, nil
+}
+
+// requireAdmin only lets requests through with a bearer token that has the scope
+func requireAdmin(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || bearer == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ApiWebResponse{Error: "authorization required"})
+			return
+		}
+
+		//compare hashes so every comparison is the same length, and check every token so timing says nothing
+		hash := sha256.Sum256([]byte(bearer))
+		var match *adminToken
+		//the tokens are checked when starting up, so there won't be an error here
+		tokens, _ := getAdminTokens()
+		for i := range tokens {
+			if subtle.ConstantTimeCompare(hash[:], tokens[i].hash[:]) == 1 {
+				match = &tokens[i]
+			}
+		}
+
+		if match == nil {
+			c.Header("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ApiWebResponse{Error: "invalid token"})
+			return
+		}
+
+		if !contains(scope, match.scopes) && !contains(ScopeAll, match.scopes) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ApiWebResponse{Error: "token does not allow " + scope})
+			return
+		}
+	}
+}
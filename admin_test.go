@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+)
+
+func TestGetAdminTokensTrimsScopes(t *testing.T) {
+	t.Setenv("ADMIN_TOKENS", " first:keys | sync ,second : *\nthird:,fourth")
+
+	tokens, err := getAdminTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []adminToken{
+		{hash: sha256.Sum256([]byte("first")), scopes: []string{ScopeKeys, ScopeSync}},
+		{hash: sha256.Sum256([]byte("second")), scopes: []string{ScopeAll}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestGetAdminTokensRejectsUnknownScopes(t *testing.T) {
+	for _, value := range []string{"token:key", "token:keys|", "token:keys||sync", "token:admin"} {
+		t.Setenv("ADMIN_TOKENS", value)
+		if _, err := getAdminTokens(); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
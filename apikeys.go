@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApiKeyPrefix starts every key we issue, so they're easy to recognise if one is leaked
+const ApiKeyPrefix = "cfw_"
+
+const AdminKeysPath = "admin/keys"
+
+// ApiKeyUsageDays is how many days of usage are given when looking at a single key
+const ApiKeyUsageDays = 30
+
+const usageDayFormat = "2006-01-02"
+
+type ApiKeyRequest struct {
+	Name              string `json:"name"`
+	RequestsPerMinute int    `json:"requests_per_minute"`
+	DailyQuota        int    `json:"daily_quota"`
+}
+
+type ApiKeyResponse struct {
+	Id                uint               `json:"id"`
+	Name              string             `json:"name"`
+	Key               string             `json:"key,omitempty"`
+	Prefix            string             `json:"prefix"`
+	RequestsPerMinute int                `json:"requests_per_minute"`
+	DailyQuota        int                `json:"daily_quota"`
+	RequestsToday     uint64             `json:"requests_today"`
+	Usage             []ApiKeyDailyUsage `json:"usage,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	RevokedAt         *time.Time         `json:"revoked_at"`
+}
+
+type ApiKeyDailyUsage struct {
+	Day      string `json:"day"`
+	Requests uint64 `json:"requests"`
+}
+
+// apiKeyStore keeps the active keys in memory so checking a key doesn't need the database, and counts the requests
+// made with them until the counts are next written out
+type apiKeyStore struct {
+	lock    sync.RWMutex
+	loaded  bool
+	keys    map[string]widget.ApiKey
+	day     string
+	today   map[uint]uint64
+	pending map[apiKeyDay]uint64
+}
+
+type apiKeyDay struct {
+	id  uint
+	day string
+}
+
+var apiKeys = &apiKeyStore{
+	keys:    make(map[string]widget.ApiKey),
+	today:   make(map[uint]uint64),
+	pending: make(map[apiKeyDay]uint64),
+}
+
+func StartApiKeySyncer() {
+	go func() {
+		syncApiKeys()
+
+		ticker := time.NewTicker(time.Minute)
+		for {
+			select {
+			case <-ticker.C:
+				syncApiKeys()
+			}
+		}
+	}()
+}
+
+// syncApiKeys writes out the usage counted since the last sync, then reloads the keys and today's usage, which picks
+// up keys created or revoked on other instances
+func syncApiKeys() {
+	db, err := GetDatabase()
+	if err != nil {
+		log.Printf("Error syncing API keys: %s\n", err.Error())
+		return
+	}
+
+	err = apiKeys.flush(db)
+	if err != nil {
+		log.Printf("Error saving API key usage: %s\n", err.Error())
+	}
+
+	err = apiKeys.load(db)
+	if err != nil {
+		log.Printf("Error loading API keys: %s\n", err.Error())
+	}
+}
+
+func (s *apiKeyStore) flush(db *gorm.DB) error {
+	s.lock.Lock()
+	pending := s.pending
+	s.pending = make(map[apiKeyDay]uint64)
+	s.lock.Unlock()
+
+	var lastErr error
+	for k, requests := range pending {
+		usage := &widget.ApiKeyUsage{ApiKeyId: k.id, Day: usageDay(k.day), Requests: requests}
+		err := db.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{"requests": gorm.Expr("requests + ?", requests)}),
+		}).Create(usage).Error
+		if err != nil {
+			//keep it for the next sync rather than losing it
+			s.lock.Lock()
+			s.pending[k] += requests
+			s.lock.Unlock()
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (s *apiKeyStore) load(db *gorm.DB) error {
+	var keys []widget.ApiKey
+	err := db.Where("revoked_at IS NULL").Find(&keys).Error
+	if err != nil {
+		return err
+	}
+
+	day := currentUsageDay()
+	var usage []widget.ApiKeyUsage
+	err = db.Where("day = ?", usageDay(day)).Find(&usage).Error
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keys = make(map[string]widget.ApiKey)
+	for _, v := range keys {
+		s.keys[v.KeyHash] = v
+	}
+
+	//the database has every instance's usage up to its last sync, and anything since then is still pending here
+	s.day = day
+	s.today = make(map[uint]uint64)
+	for _, v := range usage {
+		s.today[v.ApiKeyId] = v.Requests
+	}
+	for k, v := range s.pending {
+		if k.day == day {
+			s.today[k.id] += v
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// lookup finds an active key, loaded is false until the keys have been read from the database at least once
+func (s *apiKeyStore) lookup(key string) (apiKey widget.ApiKey, exists bool, loaded bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	apiKey, exists = s.keys[hashApiKey(key)]
+	return apiKey, exists, s.loaded
+}
+
+func (s *apiKeyStore) requestsToday(id uint) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.day != currentUsageDay() {
+		return 0
+	}
+	return s.today[id]
+}
+
+func (s *apiKeyStore) record(id uint) {
+	day := currentUsageDay()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.day != day {
+		s.day = day
+		s.today = make(map[uint]uint64)
+	}
+	s.today[id]++
+	s.pending[apiKeyDay{id: id, day: day}]++
+}
+
+func (s *apiKeyStore) add(apiKey widget.ApiKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys[apiKey.KeyHash] = apiKey
+}
+
+func (s *apiKeyStore) remove(id uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k, v := range s.keys {
+		if v.Id == id {
+			delete(s.keys, k)
+		}
+	}
+}
+
+// hideApiKey moves a key given in the query over to the X-API-Key header, so it doesn't end up in the logs or traces.
+// It has to run before anything else looks at the request.
+func hideApiKey(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if !query.Has("key") {
+		return
+	}
+
+	if c.GetHeader("X-API-Key") == "" {
+		c.Request.Header.Set("X-API-Key", query.Get("key"))
+	}
+	query.Del("key")
+	c.Request.URL.RawQuery = query.Encode()
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+}
+
+// requestApiKey gives the key from the X-API-Key header, or the key query parameter
+func requestApiKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	return c.Query("key")
+}
+
+// authenticate checks the key of requests to the API and counts them towards its usage. This runs before the cache,
+// so cached responses still need a valid key, and still count against its quota.
+func authenticate(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		return
+	}
+
+	apiKey, ok := checkApiKey(c)
+	if !ok || apiKey == nil {
+		return
+	}
+
+	apiKeys.record(apiKey.Id)
+	c.Set("apiKey", apiKey)
+}
+
+// checkApiKey finds the key the request was made with, aborting when it isn't valid or its daily quota is used up.
+// Requests without a key give nil, as do all requests until the keys have been loaded.
+func checkApiKey(c *gin.Context) (*widget.ApiKey, bool) {
+	key := requestApiKey(c)
+	if key == "" {
+		return nil, true
+	}
+
+	apiKey, exists, loaded := apiKeys.lookup(key)
+	if !loaded {
+		return nil, true
+	}
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ApiWebResponse{Error: "invalid API key"})
+		return nil, false
+	}
+
+	if apiKey.DailyQuota > 0 && apiKeys.requestsToday(apiKey.Id) >= uint64(apiKey.DailyQuota) {
+		now := time.Now().UTC()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		abortRateLimited(c, tomorrow.Sub(now))
+		return nil, false
+	}
+
+	return &apiKey, true
+}
+
+// GetApiKeys lists the keys, or gives a single key with its recent usage when there is an id
+func GetApiKeys(c *gin.Context, id string) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	requireAdmin(ScopeKeys)(c)
+	if c.IsAborted() {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	db, err := GetDatabase()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	if id == "" {
+		var keys []widget.ApiKey
+		err = db.Order("id").Find(&keys).Error
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+			return
+		}
+
+		response := make([]ApiKeyResponse, 0, len(keys))
+		for _, v := range keys {
+			response = append(response, newApiKeyResponse(v))
+		}
+		c.JSON(http.StatusOK, response)
+		c.Abort()
+		return
+	}
+
+	var key widget.ApiKey
+	err = db.Where("id = ?", cast.ToUint(id)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, ApiWebResponse{Error: "key not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	var usage []widget.ApiKeyUsage
+	since := time.Now().UTC().AddDate(0, 0, -ApiKeyUsageDays+1).Format(usageDayFormat)
+	err = db.Where("api_key_id = ? AND day >= ?", key.Id, usageDay(since)).Order("day").Find(&usage).Error
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	response := newApiKeyResponse(key)
+	response.Usage = make([]ApiKeyDailyUsage, 0, len(usage))
+	for _, v := range usage {
+		response.Usage = append(response.Usage, ApiKeyDailyUsage{Day: v.Day.Format(usageDayFormat), Requests: v.Requests})
+	}
+	c.JSON(http.StatusOK, response)
+	c.Abort()
+}
+
+// CreateApiKey issues a new key, which is only ever given in this response
+func CreateApiKey(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	var request ApiKeyRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "name must be provided"})
+		return
+	}
+	if request.RequestsPerMinute < 0 || request.DailyQuota < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "limits cannot be negative"})
+		return
+	}
+
+	secret := make([]byte, 24)
+	_, err = rand.Read(secret)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+	key := ApiKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey := widget.ApiKey{
+		Name:              request.Name,
+		KeyHash:           hashApiKey(key),
+		Prefix:            key[:len(ApiKeyPrefix)+6],
+		RequestsPerMinute: request.RequestsPerMinute,
+		DailyQuota:        request.DailyQuota,
+	}
+
+	db, err := GetDatabase()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+	err = db.Create(&apiKey).Error
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+	apiKeys.add(apiKey)
+
+	response := newApiKeyResponse(apiKey)
+	response.Key = key
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, response)
+}
+
+// RevokeApiKey stops a key from being accepted, it is kept so its usage can still be looked at
+func RevokeApiKey(c *gin.Context, id string) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	db, err := GetDatabase()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	result := db.Model(&widget.ApiKey{}).Where("id = ? AND revoked_at IS NULL", cast.ToUint(id)).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, ApiWebResponse{Error: "key not found"})
+		return
+	}
+
+	//other instances will stop accepting it on their next sync
+	apiKeys.remove(cast.ToUint(id))
+	c.Status(http.StatusNoContent)
+}
+
+func newApiKeyResponse(key widget.ApiKey) ApiKeyResponse {
+	return ApiKeyResponse{
+		Id:                key.Id,
+		Name:              key.Name,
+		Prefix:            key.Prefix,
+		RequestsPerMinute: key.RequestsPerMinute,
+		DailyQuota:        key.DailyQuota,
+		RequestsToday:     apiKeys.requestsToday(key.Id),
+		CreatedAt:         key.CreatedAt,
+		RevokedAt:         key.RevokedAt,
+	}
+}
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func currentUsageDay() string {
+	return time.Now().UTC().Format(usageDayFormat)
+}
+
+// usageDay gives the day in the timezone the database connection uses, so the right date is stored
+func usageDay(day string) time.Time {
+	t, _ := time.ParseInLocation(usageDayFormat, day, time.Local)
+	return t
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"golang.org/x/sync/errgroup"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxBatchSize limits how many ids and paths can be requested in one batch
+const MaxBatchSize = 250
+
+type BatchRequest struct {
+	Ids   []uint   `json:"ids" openapi:"anyOf"`
+	Paths []string `json:"paths" openapi:"anyOf"`
+}
+
+type BatchResponse struct {
+	Results map[string]BatchResult `json:"results" openapi:"required"`
+}
+
+type BatchResult struct {
+	Status  int                       `json:"status" openapi:"required"`
+	Error   string                    `json:"error,omitempty"`
+	Project *widget.ProjectProperties `json:"project,omitempty"`
+}
+
+func BatchCall(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	var request BatchRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	if len(request.Ids)+len(request.Paths) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "ids or paths must be provided"})
+		return
+	}
+	if len(request.Ids)+len(request.Paths) > MaxBatchSize {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "too many projects requested"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	response := BatchResponse{Results: make(map[string]BatchResult)}
+
+	//work out what id each requested item is, so we can look them all up together
+	keys := make(map[uint][]string)
+	for _, v := range request.Ids {
+		keys[v] = append(keys[v], cast.ToString(v))
+	}
+	for _, v := range request.Paths {
+		path := strings.Trim(v, "/")
+		id, err := resolveProjectId(path, ctx)
+		if errors.As(err, &RateLimitError{}) {
+			response.Results[v] = BatchResult{Status: http.StatusTooManyRequests, Error: err.Error()}
+		} else if err != nil {
+			response.Results[v] = BatchResult{Status: http.StatusInternalServerError, Error: err.Error()}
+		} else if id == nil {
+			response.Results[v] = BatchResult{Status: http.StatusNotFound}
+		} else {
+			keys[*id] = append(keys[*id], v)
+		}
+	}
+
+	ids := make([]uint, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+
+	projects, throttled, err := getBatchProjects(ids, ctx)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	for id, names := range keys {
+		result := BatchResult{Status: http.StatusNotFound}
+		if rateLimitErr, exists := throttled[id]; exists {
+			result = BatchResult{Status: http.StatusTooManyRequests, Error: rateLimitErr.Error()}
+		} else if project, exists := projects[id]; exists && project.ParsedProjects != nil && (project.Status == http.StatusOK || project.Status == http.StatusForbidden) {
+			if latest := selectDownload(project.ParsedProjects, "", ""); latest != nil {
+				project.ParsedProjects.Download = latest
+			}
+			result = BatchResult{Status: http.StatusOK, Project: project.ParsedProjects}
+		}
+
+		for _, name := range names {
+			response.Results[name] = result
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// getBatchProjects loads the projects from the database, fetching everything missing or stale from CurseForge in one
+// request rather than once per project. Each call to CurseForge takes from the client's budget, projects we have no
+// data for when they're over it are given back as throttled, while stale ones are given as we have them.
+func getBatchProjects(ids []uint, ctx context.Context) (map[uint]*widget.Project, map[uint]RateLimitError, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unique := make([]uint, 0, len(ids))
+	seen := make(map[uint]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	ids = unique
+
+	var rows []*widget.Project
+	err = db.WithContext(ctx).Where("id IN ?", ids).Find(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	projects := make(map[uint]*widget.Project)
+	for _, v := range rows {
+		projects[v.CurseId] = v
+	}
+
+	stale := make([]uint, 0)
+	for _, id := range ids {
+		v, exists := projects[id]
+		if !exists || v.ParsedProjects == nil || v.UpdatedAt.Before(time.Now().Add(-1*time.Hour)) {
+			stale = append(stale, id)
+		}
+	}
+
+	throttled := make(map[uint]RateLimitError)
+	if len(stale) == 0 {
+		return projects, throttled, nil
+	}
+
+	var rateLimitErr RateLimitError
+	if errors.As(allowUpstream(ctx), &rateLimitErr) {
+		for _, id := range stale {
+			if v, exists := projects[id]; !exists || v.ParsedProjects == nil {
+				throttled[id] = rateLimitErr
+			}
+		}
+		return projects, throttled, nil
+	}
+
+	addons, err := curseforge.GetAddons(stale, ctx)
+	if err != nil {
+		//we can still give out what we already have
+		log.Printf("Error getting projects in bulk: %s", err)
+		return projects, throttled, nil
+	}
+
+	found := make(map[uint]curseforge.Addon)
+	for _, v := range addons {
+		found[v.Id] = v
+	}
+
+	//projects we've never seen that CurseForge doesn't know about are just not found
+	toSync := make([]uint, 0, len(stale))
+	for _, id := range stale {
+		_, exists := found[id]
+		_, known := projects[id]
+		if exists || known {
+			toSync = append(toSync, id)
+		}
+	}
+
+	locker := sync.Mutex{}
+	group := errgroup.Group{}
+	group.SetLimit(4)
+	for _, id := range toSync {
+		id := id
+		addon, exists := found[id]
+
+		group.Go(func() error {
+			var project *widget.Project
+			var err error
+			if exists {
+				project, err = syncProjectConsumer.ConsumeAddon(addon, ctx)
+			} else {
+				//private projects are left out of bulk lookups, so let a full sync work out what happened
+				if err = allowUpstream(ctx); err == nil {
+					project, err = SyncProject(id, ctx)
+				}
+			}
+
+			var rateLimitErr RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				locker.Lock()
+				defer locker.Unlock()
+				if v, exists := projects[id]; !exists || v.ParsedProjects == nil {
+					throttled[id] = rateLimitErr
+				}
+				return nil
+			}
+			if err != nil {
+				log.Printf("Error syncing project %d in batch: %s", id, err)
+				return nil
+			}
+
+			locker.Lock()
+			defer locker.Unlock()
+			if project == nil {
+				delete(projects, id)
+			} else {
+				projects[id] = project
+			}
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+	return projects, throttled, nil
+}
+
+// firstRateLimit gives any one of the rate limits from getBatchProjects, for when they all mean the same to the client
+func firstRateLimit(throttled map[uint]RateLimitError) *RateLimitError {
+	for _, v := range throttled {
+		return &v
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,6 +32,15 @@ func init() {
 	go func() {
 		cleanCache()
 	}()
+
+	metrics.RegisterCacheSize(func() int {
+		size := 0
+		memcache.Range(func(k, v interface{}) bool {
+			size++
+			return true
+		})
+		return size
+	})
 }
 
 func GetFromCache(site, key string) (CachedResponse, bool) {
@@ -53,8 +64,17 @@ func SetInCache(site, key string, status int, contentType string, data interface
 	return cache.ExpireAt
 }
 
+// RemoveFromCache removes the key, along with any variants of it stored under key#...
 func RemoveFromCache(site, key string) {
 	memcache.Delete(site + ":" + key)
+
+	prefix := site + ":" + key + "#"
+	memcache.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			memcache.Delete(k)
+		}
+		return true
+	})
 }
 
 func cleanCache() {
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/sync/singleflight"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ChangelogResponse struct {
+	Id       uint   `json:"id" openapi:"required"`
+	FileId   uint   `json:"file_id" openapi:"required"`
+	Html     string `json:"html" openapi:"required"`
+	Markdown string `json:"markdown" openapi:"required"`
+}
+
+// allowedChangelogTags are kept along with their allowed attributes, anything else is unwrapped
+var allowedChangelogTags = map[atom.Atom][]string{
+	atom.P:          {},
+	atom.Br:         {},
+	atom.Hr:         {},
+	atom.A:          {"href"},
+	atom.Ul:         {},
+	atom.Ol:         {},
+	atom.Li:         {},
+	atom.Strong:     {},
+	atom.B:          {},
+	atom.Em:         {},
+	atom.I:          {},
+	atom.U:          {},
+	atom.S:          {},
+	atom.Del:        {},
+	atom.Code:       {},
+	atom.Pre:        {},
+	atom.Blockquote: {},
+	atom.H1:         {},
+	atom.H2:         {},
+	atom.H3:         {},
+	atom.H4:         {},
+	atom.H5:         {},
+	atom.H6:         {},
+	atom.Img:        {"src", "alt"},
+}
+
+// droppedChangelogTags are removed along with everything in them
+var droppedChangelogTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Template: true,
+	atom.Noscript: true,
+}
+
+// ChangelogTTL is how long a file's changelog is kept, they don't change once the file is uploaded
+const ChangelogTTL = 24 * time.Hour
+
+type cachedChangelog struct {
+	fileId   uint
+	html     string
+	markdown string
+	expireAt time.Time
+}
+
+func (c cachedChangelog) size() int64 {
+	return int64(len(c.html) + len(c.markdown))
+}
+
+// changelogs are kept by file id, separately from the response cache so every format and widget shares them
+var changelogs = newChangelogCache(int64(env.GetIntOr("CHANGELOG_CACHE_MB", 16)) << 20)
+var changelogLoads singleflight.Group
+
+// changelogCache is a LRU of changelogs, bounded by their size so walking file ids can't grow it without limit
+type changelogCache struct {
+	lock     sync.Mutex
+	entries  map[uint]*list.Element
+	order    *list.List
+	size     int64
+	maxBytes int64
+}
+
+func newChangelogCache(maxBytes int64) *changelogCache {
+	return &changelogCache{
+		entries:  make(map[uint]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+	}
+}
+
+func (cache *changelogCache) get(fileId uint) (cachedChangelog, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	e, exists := cache.entries[fileId]
+	if !exists {
+		return cachedChangelog{}, false
+	}
+
+	changelog := e.Value.(cachedChangelog)
+	if time.Now().After(changelog.expireAt) {
+		cache.remove(e)
+		return cachedChangelog{}, false
+	}
+	cache.order.MoveToFront(e)
+	return changelog, true
+}
+
+func (cache *changelogCache) set(changelog cachedChangelog) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if e, exists := cache.entries[changelog.fileId]; exists {
+		cache.remove(e)
+	}
+
+	//never store something which would evict everything else
+	if changelog.size() > cache.maxBytes {
+		return
+	}
+
+	cache.entries[changelog.fileId] = cache.order.PushFront(changelog)
+	cache.size += changelog.size()
+
+	for cache.size > cache.maxBytes {
+		last := cache.order.Back()
+		if last == nil {
+			break
+		}
+		cache.remove(last)
+	}
+}
+
+// remove takes the entry out, the lock must already be held
+func (cache *changelogCache) remove(e *list.Element) {
+	old := cache.order.Remove(e).(cachedChangelog)
+	delete(cache.entries, old.fileId)
+	cache.size -= old.size()
+}
+
+var blankLinesRegex = regexp.MustCompile("\n{3,}")
+var whitespaceRegex = regexp.MustCompile("\\s+")
+
+// getChangelog handles files/{fileId}/changelog for a project which has already been resolved
+func getChangelog(c *gin.Context, properties *widget.ProjectProperties, fileId uint) {
+	if !hasFile(properties, fileId) {
+		SetInCache(c.Request.Host, cacheKey(c), http.StatusNotFound, "", nil)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	changelog, err := loadChangelog(properties.Id, fileId, c.Request.Context())
+	var rateLimitErr RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		abortRateLimited(c, rateLimitErr.RetryAfter)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting changelog for %d/%d: %s", properties.Id, fileId, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	response := ChangelogResponse{
+		Id:       properties.Id,
+		FileId:   fileId,
+		Html:     changelog.html,
+		Markdown: changelog.markdown,
+	}
+
+	format := c.Query("format")
+	if format == "" && c.Request.Host != env.Get("API_HOSTNAME") {
+		format = "html"
+	}
+
+	var contentType string
+	var data interface{}
+	switch format {
+	case "html":
+		contentType, data = "text/html; charset=utf-8", []byte(response.Html)
+	case "markdown":
+		contentType, data = "text/markdown; charset=utf-8", []byte(response.Markdown)
+	default:
+		contentType, data = "application/json", response
+	}
+
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, contentType, data)
+	cacheHeaders(c, cacheExpireTime)
+	if bytes, ok := data.([]byte); ok {
+		c.Data(http.StatusOK, contentType, bytes)
+	} else {
+		c.JSON(http.StatusOK, data)
+	}
+	c.Abort()
+}
+
+// getWidgetChangelog gives the sanitized changelog for the widget, an empty changelog just isn't shown
+func getWidgetChangelog(c *gin.Context, properties *widget.ProjectProperties) string {
+	if properties == nil || properties.Download == nil {
+		return ""
+	}
+
+	changelog, err := loadChangelog(properties.Id, properties.Download.Id, c.Request.Context())
+	if err != nil {
+		log.Printf("Error getting changelog for %d/%d: %s", properties.Id, properties.Download.Id, err)
+		return ""
+	}
+
+	return changelog.html
+}
+
+// loadChangelog gives the sanitized changelog for a file, only going to CurseForge the first time it's asked for
+func loadChangelog(projectId, fileId uint, ctx context.Context) (cachedChangelog, error) {
+	if cached, exists := changelogs.get(fileId); exists {
+		return cached, nil
+	}
+
+	if err := allowUpstream(ctx); err != nil {
+		return cachedChangelog{}, err
+	}
+
+	result, err, _ := changelogLoads.Do(strconv.FormatUint(uint64(fileId), 10), func() (interface{}, error) {
+		//the fetch is shared, so one caller going away shouldn't fail it for everyone else
+		raw, err := curseforge.GetChangelog(projectId, fileId, context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		nodes := sanitizeChangelog(raw)
+		changelog := cachedChangelog{
+			fileId:   fileId,
+			html:     renderChangelogHtml(nodes),
+			markdown: renderChangelogMarkdown(nodes),
+			expireAt: time.Now().Add(ChangelogTTL),
+		}
+		changelogs.set(changelog)
+		return changelog, nil
+	})
+	if err != nil {
+		return cachedChangelog{}, err
+	}
+	return result.(cachedChangelog), nil
+}
+
+func hasFile(properties *widget.ProjectProperties, fileId uint) bool {
+	for _, v := range properties.Files {
+		if v.Id == fileId {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeChangelog parses the changelog CurseForge gives us, keeping only the allowed tags and attributes
+func sanitizeChangelog(raw string) []*html.Node {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(raw), body)
+	if err != nil {
+		return []*html.Node{{Type: html.TextNode, Data: raw}}
+	}
+
+	result := make([]*html.Node, 0, len(nodes))
+	for _, v := range nodes {
+		result = append(result, sanitizeNode(v)...)
+	}
+	return result
+}
+
+func sanitizeNode(node *html.Node) []*html.Node {
+	switch node.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: node.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	if droppedChangelogTags[node.DataAtom] {
+		return nil
+	}
+
+	children := make([]*html.Node, 0)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		children = append(children, sanitizeNode(child)...)
+	}
+
+	allowed, exists := allowedChangelogTags[node.DataAtom]
+	if !exists {
+		//unknown tags are unwrapped so the text in them is kept
+		return children
+	}
+
+	clean := &html.Node{Type: html.ElementNode, Data: node.Data, DataAtom: node.DataAtom}
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || !contains(attr.Key, allowed) {
+			continue
+		}
+		if (attr.Key == "href" || attr.Key == "src") && !isSafeUrl(attr.Val) {
+			continue
+		}
+		clean.Attr = append(clean.Attr, html.Attribute{Key: attr.Key, Val: attr.Val})
+	}
+
+	switch node.DataAtom {
+	case atom.A:
+		clean.Attr = append(clean.Attr, html.Attribute{Key: "rel", Val: "nofollow noopener"}, html.Attribute{Key: "target", Val: "_blank"})
+	case atom.Img:
+		if getAttribute(clean, "src") == "" {
+			return nil
+		}
+	}
+
+	for _, child := range children {
+		clean.AppendChild(child)
+	}
+	return []*html.Node{clean}
+}
+
+func isSafeUrl(u string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
+
+var markdownUrlReplacer = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+// markdownUrl checks the url against the same schemes as the sanitizer, and escapes anything which would end the link
+func markdownUrl(u string) (string, bool) {
+	if !isSafeUrl(u) {
+		return "", false
+	}
+	return markdownUrlReplacer.Replace(strings.TrimSpace(u)), true
+}
+
+func getAttribute(node *html.Node, key string) string {
+	for _, v := range node.Attr {
+		if v.Key == key {
+			return v.Val
+		}
+	}
+	return ""
+}
+
+func renderChangelogHtml(nodes []*html.Node) string {
+	builder := &strings.Builder{}
+	for _, v := range nodes {
+		_ = html.Render(builder, v)
+	}
+	return builder.String()
+}
+
+func renderChangelogMarkdown(nodes []*html.Node) string {
+	builder := &strings.Builder{}
+	for _, v := range nodes {
+		writeMarkdown(builder, v, "")
+	}
+	//lines that are only the list or quote indent are really blank
+	lines := strings.Split(builder.String(), "\n")
+	for i, v := range lines {
+		if strings.TrimSpace(v) == "" {
+			lines[i] = ""
+		}
+	}
+
+	return strings.TrimSpace(blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")) + "\n"
+}
+
+// writeMarkdown writes a sanitized node, prefix is what each new line starts with inside lists and quotes
+func writeMarkdown(builder *strings.Builder, node *html.Node, prefix string) {
+	if node.Type == html.TextNode {
+		text := whitespaceRegex.ReplaceAllString(node.Data, " ")
+		builder.WriteString(markdownEscape(text))
+		return
+	}
+
+	children := func(prefix string) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			writeMarkdown(builder, child, prefix)
+		}
+	}
+
+	switch node.DataAtom {
+	case atom.P:
+		builder.WriteString("\n\n" + prefix)
+		children(prefix)
+		builder.WriteString("\n\n" + prefix)
+	case atom.Br:
+		builder.WriteString("  \n" + prefix)
+	case atom.Hr:
+		builder.WriteString("\n\n" + prefix + "---\n\n" + prefix)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		builder.WriteString("\n\n" + prefix + strings.Repeat("#", level) + " ")
+		children(prefix)
+		builder.WriteString("\n\n" + prefix)
+	case atom.Strong, atom.B:
+		builder.WriteString("**")
+		children(prefix)
+		builder.WriteString("**")
+	case atom.Em, atom.I:
+		builder.WriteString("_")
+		children(prefix)
+		builder.WriteString("_")
+	case atom.S, atom.Del:
+		builder.WriteString("~~")
+		children(prefix)
+		builder.WriteString("~~")
+	case atom.Code:
+		builder.WriteString("`" + textContent(node) + "`")
+	case atom.Pre:
+		builder.WriteString("\n\n" + prefix + "```\n" + prefix)
+		builder.WriteString(strings.ReplaceAll(strings.Trim(textContent(node), "\n"), "\n", "\n"+prefix))
+		builder.WriteString("\n" + prefix + "```\n\n" + prefix)
+	case atom.Blockquote:
+		builder.WriteString("\n\n" + prefix + "> ")
+		children(prefix + "> ")
+		builder.WriteString("\n\n" + prefix)
+	case atom.Ul, atom.Ol:
+		builder.WriteString("\n" + prefix)
+		index := 1
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.DataAtom != atom.Li {
+				continue
+			}
+			marker := "- "
+			if node.DataAtom == atom.Ol {
+				marker = fmt.Sprintf("%d. ", index)
+			}
+			builder.WriteString("\n" + prefix + marker)
+			for item := child.FirstChild; item != nil; item = item.NextSibling {
+				writeMarkdown(builder, item, prefix+strings.Repeat(" ", len(marker)))
+			}
+			index++
+		}
+		builder.WriteString("\n\n" + prefix)
+	case atom.A:
+		//links without somewhere safe to go are just their text
+		href, safe := markdownUrl(getAttribute(node, "href"))
+		if !safe {
+			children(prefix)
+			return
+		}
+		builder.WriteString("[")
+		children(prefix)
+		builder.WriteString("](" + href + ")")
+	case atom.Img:
+		src, safe := markdownUrl(getAttribute(node, "src"))
+		if !safe {
+			builder.WriteString(markdownEscape(getAttribute(node, "alt")))
+			return
+		}
+		builder.WriteString(fmt.Sprintf("![%s](%s)", markdownEscape(getAttribute(node, "alt")), src))
+	default:
+		children(prefix)
+	}
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	builder := &strings.Builder{}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(textContent(child))
+	}
+	return builder.String()
+}
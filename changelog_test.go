@@ -0,0 +1,87 @@
+package main
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangelogCacheEvictsOldest(t *testing.T) {
+	cache := newChangelogCache(30)
+	expireAt := time.Now().Add(time.Hour)
+
+	cache.set(cachedChangelog{fileId: 1, html: "0123456789", expireAt: expireAt})
+	cache.set(cachedChangelog{fileId: 2, html: "0123456789", expireAt: expireAt})
+	//using 1 leaves 2 as the oldest
+	if _, exists := cache.get(1); !exists {
+		t.Fatal("expected 1 to be cached")
+	}
+	cache.set(cachedChangelog{fileId: 3, html: "0123456789", markdown: "0123456789", expireAt: expireAt})
+
+	if _, exists := cache.get(2); exists {
+		t.Error("expected 2 to be evicted")
+	}
+	for _, id := range []uint{1, 3} {
+		if _, exists := cache.get(id); !exists {
+			t.Errorf("expected %d to be cached", id)
+		}
+	}
+	if cache.size > cache.maxBytes {
+		t.Errorf("cache holds %d bytes, over its %d", cache.size, cache.maxBytes)
+	}
+
+	//too large to ever fit
+	cache.set(cachedChangelog{fileId: 4, html: strings.Repeat("a", 31), expireAt: expireAt})
+	if _, exists := cache.get(4); exists {
+		t.Error("expected 4 not to be cached")
+	}
+}
+
+func TestChangelogCacheExpires(t *testing.T) {
+	cache := newChangelogCache(1 << 10)
+	cache.set(cachedChangelog{fileId: 1, html: "old", expireAt: time.Now().Add(-time.Second)})
+
+	if _, exists := cache.get(1); exists {
+		t.Error("expected the expired changelog not to be given")
+	}
+	if cache.size != 0 || len(cache.entries) != 0 {
+		t.Error("expected the expired changelog to be removed")
+	}
+}
+
+func TestChangelogMarkdownDropsUnsafeLinks(t *testing.T) {
+	tests := map[string]string{
+		`<a href="https://example.com/a">ok</a>`:                 "[ok](https://example.com/a)",
+		`<a href="https://example.com/a b(c)">ok</a>`:            "[ok](https://example.com/a%20b%28c%29)",
+		`<a href="javascript:alert(1)">bad</a>`:                  "bad",
+		`<a href="JavaScript:alert(1)">bad</a>`:                  "bad",
+		`<a href="data:text/html,hi">bad</a>`:                    "bad",
+		`<a href="/relative">bad</a>`:                            "bad",
+		`<a href="https://x.com/)[y](javascript:alert(1)">x</a>`: "[x](https://x.com/%29[y]%28javascript:alert%281%29)",
+		`<img src="javascript:alert(1)" alt="pic">`:              "",
+		`<img src="https://example.com/a.png" alt="pic">`:        "![pic](https://example.com/a.png)",
+	}
+
+	for raw, expected := range tests {
+		if markdown := strings.TrimSpace(renderChangelogMarkdown(sanitizeChangelog(raw))); markdown != expected {
+			t.Errorf("expected %s to give %q, got %q", raw, expected, markdown)
+		}
+		//the markdown is rendered from what the sanitizer left, so check the writer on its own too
+		if markdown := strings.TrimSpace(renderChangelogMarkdown(parseTestNodes(t, raw))); strings.Contains(strings.ToLower(markdown), "](javascript:") {
+			t.Errorf("expected %s not to give a javascript link, got %q", raw, markdown)
+		}
+	}
+}
+
+// parseTestNodes parses the changelog without sanitizing it
+func parseTestNodes(t *testing.T, raw string) []*html.Node {
+	t.Helper()
+
+	nodes, err := html.ParseFragment(strings.NewReader(raw), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
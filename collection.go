@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"golang.org/x/sync/errgroup"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const CollectionPath = "collection"
+
+// MaxCollectionSize limits how many projects one collection can resolve, as each may need a sync
+const MaxCollectionSize = 25
+
+func GetCollection(c *gin.Context) {
+	ids := make([]string, 0)
+	for _, v := range strings.Split(c.Query("ids"), ",") {
+		v = strings.Trim(strings.TrimSpace(v), "/")
+		if v != "" {
+			ids = append(ids, v)
+		}
+	}
+
+	if len(ids) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "ids must be provided"})
+		return
+	}
+	if len(ids) > MaxCollectionSize {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "too many ids requested"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	versionRequest := c.Query("version")
+	loader := c.Query("loader")
+
+	//resolve them all at once, but keep the order they were requested in
+	results := make([]*widget.ProjectProperties, len(ids))
+	var rateLimited *RateLimitError
+	locker := sync.Mutex{}
+	group := errgroup.Group{}
+	group.SetLimit(4)
+	for i, path := range ids {
+		i, path := i, path
+		group.Go(func() error {
+			project, _, err := resolveProject(path, ctx)
+			var rateLimitErr RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				locker.Lock()
+				rateLimited = &rateLimitErr
+				locker.Unlock()
+				return nil
+			}
+			if err != nil {
+				//one broken project shouldn't take the rest of the collection down with it
+				log.Printf("Error resolving %s for collection: %s", path, err)
+				return nil
+			}
+			if project == nil || project.ParsedProjects == nil {
+				return nil
+			}
+
+			properties := project.ParsedProjects
+			if latest := selectDownload(properties, versionRequest, loader); latest != nil {
+				properties.Download = latest
+			}
+			results[i] = properties
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	//rather than quietly giving back a collection missing projects
+	if rateLimited != nil {
+		abortRateLimited(c, rateLimited.RetryAfter)
+		return
+	}
+
+	projects := make([]*widget.ProjectProperties, 0, len(results))
+	for _, v := range results {
+		if v != nil {
+			projects = append(projects, v)
+		}
+	}
+
+	if c.Request.Host == env.Get("API_HOSTNAME") {
+		response := getFieldSelection(c).apply(projects)
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", response)
+		cacheHeaders(c, cacheExpireTime)
+		c.JSON(http.StatusOK, response)
+		c.Abort()
+		return
+	}
+
+	if len(projects) == 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(c.Param("projectPath"), "/")
+	if _, format, isImage := splitImageExtension(path); isImage {
+		imageRequest := newImageRequest(c, format)
+
+		data, err := generateCollectionImage(projects, cast.ToInt(c.DefaultQuery("columns", "1")), imageRequest, ctx)
+		if err != nil {
+			log.Print(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		contentType := imageContentTypes[imageRequest.Format]
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, contentType, data)
+		cacheHeaders(c, cacheExpireTime)
+
+		c.Data(http.StatusOK, contentType, data)
+	} else {
+		localizer := NewLocalizer(requestLanguage(c))
+		theme := getWidgetTheme(c)
+		borderClass := getBorderClass(c)
+
+		items := make([]gin.H, 0, len(projects))
+		for _, v := range projects {
+			items = append(items, gin.H{
+				"project":       v,
+				"downloadCount": localizer.Number(v.Downloads["total"]),
+				"theme":         theme,
+				"borderClass":   borderClass,
+				"i18n":          localizer,
+			})
+		}
+
+		buf := &bytes.Buffer{}
+		_ = templateEngine.ExecuteTemplate(buf, "collection.tmpl", gin.H{
+			"items": items,
+			"theme": theme,
+			"i18n":  localizer,
+		})
+		data := buf.Bytes()
+
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "text/html", data)
+		cacheHeaders(c, cacheExpireTime)
+		c.Data(http.StatusOK, "text/html", data)
+	}
+	c.Abort()
+}
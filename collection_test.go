@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCollectionWidgetHasUniqueIds checks each project in a collection doesn't repeat the ids of the others
+func TestCollectionWidgetHasUniqueIds(t *testing.T) {
+	t.Setenv("API_HOSTNAME", testApiHost)
+	t.Setenv("WEB_HOSTNAME", testWebHost)
+	setupTestDatabase(t)
+
+	engine := gin.New()
+	RegisterApiRoutes(engine)
+
+	request := httptest.NewRequest("GET", "/collection?ids=1000,1001", nil)
+	request.Host = testWebHost
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	doc, err := html.Parse(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if id := getAttribute(node, "id"); id != "" {
+			if seen[id] {
+				t.Errorf("id %s is used more than once", id)
+			}
+			seen[id] = true
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+}
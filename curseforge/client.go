@@ -7,25 +7,23 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cfwidget/cfwidget/env"
-	"go.elastic.co/apm/module/apmhttp/v2"
-	"go.elastic.co/apm/v2"
-	"image"
+	"github.com/cfwidget/cfwidget/metrics"
+	"github.com/cfwidget/cfwidget/tracing"
+	"github.com/spf13/cast"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 )
 
 var client *http.Client
 
-var gameCache = make(map[uint]Game)
-var categoryCache = make(map[uint][]Category)
-
 const PageSize = 50
 
 func init() {
-	client = apmhttp.WrapClient(&http.Client{})
+	client = tracing.WrapClient(&http.Client{})
 }
 
 func StartGameCacheSyncer() {
@@ -43,54 +41,79 @@ func StartGameCacheSyncer() {
 				if err != nil {
 					log.Printf("Error updating game cache: %s\n", err.Error())
 				}
+				updateCategoryCache()
 			}
 		}
 	}()
 }
 
 func Call(u string, ctx context.Context) (*http.Response, error) {
-	key := os.Getenv("CORE_KEY")
-
 	request, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	return do(request)
+}
+
+func Post(u string, body interface{}, ctx context.Context) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	return do(request)
+}
+
+func do(request *http.Request) (*http.Response, error) {
+	key := os.Getenv("CORE_KEY")
+
 	request.Header.Add("x-api-key", key)
 
+	start := time.Now()
 	response, err := client.Do(request)
+	status := 0
+	if err == nil {
+		status = response.StatusCode
+	}
+	metrics.ObserveCurseForge(request.URL.Path, status, time.Since(start))
 
-	if env.GetBool("DEBUG") {
+	if err == nil && env.GetBool("DEBUG") {
 		//clone body so we can "replace" it
 		body, _ := io.ReadAll(response.Body)
 		_ = response.Body.Close()
 		response.Body = io.NopCloser(bytes.NewBuffer(body))
-		log.Printf("URL %s\nResult: %s\nBody: %s\n", u, response.Status, string(body))
+		log.Printf("URL %s\nResult: %s\nBody: %s\n", request.URL.String(), response.Status, string(body))
 	}
 
 	return response, err
 }
 
 func updateGameCache() error {
-	trans := apm.DefaultTracer().StartTransaction("gameCacheSync", "schedule")
+	trans, ctx := tracing.StartTransaction(context.Background(), "gameCacheSync", "schedule")
 	defer trans.End()
 
 	defer func() {
 		err := recover()
 		if err != nil {
-			trans.Outcome = "failure"
+			trans.SetFailed()
 		}
 	}()
 
-	ctx := apm.ContextWithTransaction(context.Background(), trans)
-
 	games := make([]Game, 0)
 	page := uint(0)
 
 	for {
 		response, err := getGames(page, ctx)
 		if err != nil {
-			trans.Outcome = "failure"
+			trans.SetFailed()
 			return err
 		}
 
@@ -106,16 +129,31 @@ func updateGameCache() error {
 		page++
 	}
 
-	newMap := make(map[uint]Game)
-	for _, v := range games {
-		newMap[v.Id] = v
-	}
-	gameCache = newMap
+	metadata.setGames(games)
 	return nil
 }
 
+// updateCategoryCache refreshes the categories of every game that has been asked for, so requests never wait on them
+func updateCategoryCache() {
+	trans, ctx := tracing.StartTransaction(context.Background(), "categoryCacheSync", "schedule")
+	defer trans.End()
+
+	for _, gameId := range metadata.categoryGames() {
+		_, err := metadata.loadCategories(gameId, ctx)
+		if err != nil {
+			trans.SetFailed()
+			log.Printf("Error updating categories for game %d: %s\n", gameId, err.Error())
+		}
+	}
+}
+
 func GetGame(gameId uint) Game {
-	return gameCache[gameId]
+	return metadata.getGame(gameId)
+}
+
+// GetGames lists every game we know about, sorted by name
+func GetGames() []Game {
+	return metadata.getGames()
 }
 
 func GetCategories(gameId uint, ctx context.Context) ([]Category, error) {
@@ -123,10 +161,21 @@ func GetCategories(gameId uint, ctx context.Context) ([]Category, error) {
 		return make([]Category, 0), nil
 	}
 
-	if categories, exists := categoryCache[gameId]; exists {
-		return categories, nil
+	cached, exists, fresh := metadata.getCategories(gameId)
+	if fresh {
+		return cached, nil
 	}
 
+	categories, err := metadata.loadCategories(gameId, ctx)
+	if err != nil && exists {
+		//old categories are still better than none
+		log.Printf("Error refreshing categories for game %d: %s\n", gameId, err.Error())
+		return cached, nil
+	}
+	return categories, err
+}
+
+func fetchCategories(gameId uint, ctx context.Context) ([]Category, error) {
 	categories := make([]Category, 0)
 	page := uint(0)
 
@@ -148,7 +197,6 @@ func GetCategories(gameId uint, ctx context.Context) ([]Category, error) {
 		page++
 	}
 
-	categoryCache[gameId] = categories
 	return categories, nil
 }
 
@@ -169,13 +217,7 @@ func GetPrimaryCategoryFor(categories []Category, id uint) Category {
 }
 
 func GetGameBySlug(slug string) Game {
-	for _, v := range gameCache {
-		if v.Slug == slug {
-			return v
-		}
-	}
-
-	return Game{}
+	return metadata.getGameBySlug(slug)
 }
 
 func getCategories(gameId, page uint, ctx context.Context) (CategoryResponse, error) {
@@ -210,6 +252,112 @@ func getGames(page uint, ctx context.Context) (GameResponse, error) {
 	return data, err
 }
 
+// Search runs a search against CurseForge, any zero values in the request are left out
+func Search(request SearchRequest, ctx context.Context) (SearchResponse, error) {
+	query := url.Values{}
+	query.Set("gameId", cast.ToString(request.GameId))
+	query.Set("index", cast.ToString(request.Index))
+	query.Set("pageSize", cast.ToString(request.PageSize))
+	if request.ClassId != 0 {
+		query.Set("classId", cast.ToString(request.ClassId))
+	}
+	if request.CategoryId != 0 {
+		query.Set("categoryId", cast.ToString(request.CategoryId))
+	}
+	if request.SearchFilter != "" {
+		query.Set("searchFilter", request.SearchFilter)
+	}
+	if request.GameVersion != "" {
+		query.Set("gameVersion", request.GameVersion)
+	}
+	if request.ModLoaderType != 0 {
+		query.Set("modLoaderType", cast.ToString(request.ModLoaderType))
+	}
+	if request.SortField != 0 {
+		query.Set("sortField", cast.ToString(request.SortField))
+	}
+	if request.SortOrder != "" {
+		query.Set("sortOrder", request.SortOrder)
+	}
+
+	response, err := Call("https://api.curseforge.com/v1/mods/search?"+query.Encode(), ctx)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return SearchResponse{}, errors.New(fmt.Sprintf("invalid status code: %s", response.Status))
+	}
+
+	var data SearchResponse
+	err = json.NewDecoder(response.Body).Decode(&data)
+	return data, err
+}
+
+// GetAddons fetches many projects in one request, projects which don't exist or are private are left out
+func GetAddons(ids []uint, ctx context.Context) ([]Addon, error) {
+	if len(ids) == 0 {
+		return make([]Addon, 0), nil
+	}
+
+	response, err := Post("https://api.curseforge.com/v1/mods", ModsRequest{ModIds: ids}, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, errors.New(fmt.Sprintf("invalid status code: %s", response.Status))
+	}
+
+	var data ProjectsResponse
+	err = json.NewDecoder(response.Body).Decode(&data)
+	return data.Data, err
+}
+
+// GetFilesById fetches many files in one request, files which don't exist are left out
+func GetFilesById(ids []uint, ctx context.Context) ([]File, error) {
+	if len(ids) == 0 {
+		return make([]File, 0), nil
+	}
+
+	response, err := Post("https://api.curseforge.com/v1/mods/files", FilesRequest{FileIds: ids}, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, errors.New(fmt.Sprintf("invalid status code: %s", response.Status))
+	}
+
+	var data FileListResponse
+	err = json.NewDecoder(response.Body).Decode(&data)
+	return data.Data, err
+}
+
+// GetChangelog gets the changelog for a file as the HTML CurseForge stores it, a missing changelog is just empty
+func GetChangelog(projectId, fileId uint, ctx context.Context) (string, error) {
+	response, err := Call(fmt.Sprintf("https://api.curseforge.com/v1/mods/%d/files/%d/changelog", projectId, fileId), ctx)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == 404 {
+		return "", nil
+	}
+
+	if response.StatusCode != 200 {
+		return "", errors.New(fmt.Sprintf("invalid status code: %s", response.Status))
+	}
+
+	var data DescriptionResponse
+	err = json.NewDecoder(response.Body).Decode(&data)
+	return data.Data, err
+}
+
 func GetFiles(projectId uint, ctx context.Context) ([]File, error) {
 	files := make([]File, 0)
 	page := uint(0)
@@ -256,19 +404,3 @@ func getFilesForPage(projectId, page uint, ctx context.Context) (FilesResponse,
 	err = json.NewDecoder(response.Body).Decode(&files)
 	return files, err
 }
-
-func GetThumbnail(url string, ctx context.Context) (image.Image, error) {
-	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	img, _, err := image.Decode(response.Body)
-	return img, err
-}
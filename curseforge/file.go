@@ -0,0 +1,49 @@
+package curseforge
+
+import "strings"
+
+// SplitGameVersions splits what CurseForge lists as a file's game versions into the loaders and the actual game
+// versions, leaving out environments and Java versions
+func (f File) SplitGameVersions() (loaders []string, gameVersions []string) {
+	loaders = make([]string, 0)
+	gameVersions = make([]string, 0)
+
+	if len(f.SortableGameVersions) > 0 {
+		for _, v := range f.SortableGameVersions {
+			if IsModLoader(v.GameVersionName) {
+				loaders = appendUnique(loaders, v.GameVersionName)
+			} else if v.GameVersion != "" {
+				gameVersions = appendUnique(gameVersions, v.GameVersionName)
+			}
+		}
+		return
+	}
+
+	//older files don't always have the sortable versions, so work it out from the names
+	for _, v := range f.GameVersions {
+		if IsModLoader(v) {
+			loaders = appendUnique(loaders, v)
+		} else if !isEnvironment(v) {
+			gameVersions = appendUnique(gameVersions, v)
+		}
+	}
+	return
+}
+
+// IsModLoader checks the name against the loaders CurseForge knows, plus Rift which only exists as a game version
+func IsModLoader(name string) bool {
+	return GetModLoaderType(name) != 0 || strings.EqualFold(name, "rift")
+}
+
+func isEnvironment(name string) bool {
+	return strings.EqualFold(name, "client") || strings.EqualFold(name, "server") || strings.HasPrefix(strings.ToLower(name), "java ")
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
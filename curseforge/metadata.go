@@ -0,0 +1,126 @@
+package curseforge
+
+import (
+	"context"
+	"golang.org/x/sync/singleflight"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CategoryTTL is how long categories are used before being fetched again
+const CategoryTTL = 6 * time.Hour
+
+var metadata = newMetadataStore()
+
+// metadataStore holds the games and categories, which change rarely but are read on nearly every request
+type metadataStore struct {
+	lock        sync.RWMutex
+	games       map[uint]Game
+	gamesBySlug map[string]Game
+	categories  map[uint]categoryEntry
+	loads       singleflight.Group
+
+	//fetch and now are only swapped out by the tests
+	fetch func(gameId uint, ctx context.Context) ([]Category, error)
+	now   func() time.Time
+}
+
+type categoryEntry struct {
+	categories []Category
+	loadedAt   time.Time
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{
+		games:       make(map[uint]Game),
+		gamesBySlug: make(map[string]Game),
+		categories:  make(map[uint]categoryEntry),
+		fetch:       fetchCategories,
+		now:         time.Now,
+	}
+}
+
+func (store *metadataStore) setGames(games []Game) {
+	byId := make(map[uint]Game, len(games))
+	bySlug := make(map[string]Game, len(games))
+	for _, v := range games {
+		byId[v.Id] = v
+		bySlug[v.Slug] = v
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.games = byId
+	store.gamesBySlug = bySlug
+}
+
+func (store *metadataStore) getGame(id uint) Game {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.games[id]
+}
+
+func (store *metadataStore) getGameBySlug(slug string) Game {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.gamesBySlug[slug]
+}
+
+func (store *metadataStore) getGames() []Game {
+	store.lock.RLock()
+	games := make([]Game, 0, len(store.games))
+	for _, v := range store.games {
+		games = append(games, v)
+	}
+	store.lock.RUnlock()
+
+	sort.Slice(games, func(i, j int) bool {
+		return strings.ToLower(games[i].Name) < strings.ToLower(games[j].Name)
+	})
+	return games
+}
+
+// getCategories gives back the cached categories and if they are still fresh
+func (store *metadataStore) getCategories(gameId uint) ([]Category, bool, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	entry, exists := store.categories[gameId]
+	return entry.categories, exists, exists && store.now().Sub(entry.loadedAt) < CategoryTTL
+}
+
+func (store *metadataStore) setCategories(gameId uint, categories []Category) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.categories[gameId] = categoryEntry{categories: categories, loadedAt: store.now()}
+}
+
+// categoryGames lists the games which have had their categories requested, so they can be kept fresh
+func (store *metadataStore) categoryGames() []uint {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	ids := make([]uint, 0, len(store.categories))
+	for id := range store.categories {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// loadCategories fetches the categories for a game, with concurrent requests for the same game sharing one fetch
+func (store *metadataStore) loadCategories(gameId uint, ctx context.Context) ([]Category, error) {
+	result, err, _ := store.loads.Do(strconv.FormatUint(uint64(gameId), 10), func() (interface{}, error) {
+		//the fetch is shared, so one caller going away shouldn't fail it for everyone else
+		categories, err := store.fetch(gameId, context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		store.setCategories(gameId, categories)
+		return categories, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]Category), nil
+}
@@ -0,0 +1,177 @@
+package curseforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetadataConcurrentReadsDuringRefresh(t *testing.T) {
+	store := newMetadataStore()
+	store.fetch = func(gameId uint, ctx context.Context) ([]Category, error) {
+		time.Sleep(time.Millisecond)
+		return []Category{{Id: gameId, Name: "Mods"}}, nil
+	}
+	store.setGames([]Game{{Id: 432, Name: "Minecraft", Slug: "minecraft"}})
+
+	ctx := context.Background()
+	stop := make(chan struct{})
+	writers := &sync.WaitGroup{}
+	writers.Add(2)
+	go func() {
+		defer writers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			store.setGames([]Game{{Id: 432, Name: "Minecraft", Slug: "minecraft"}, {Id: uint(1000 + i), Name: fmt.Sprint(i), Slug: fmt.Sprint(i)}})
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := store.loadCategories(432, ctx); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	readers := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for j := 0; j < 500; j++ {
+				if game := store.getGameBySlug("minecraft"); game.Id != 432 {
+					t.Errorf("expected game 432, got %d", game.Id)
+					return
+				}
+				_ = store.getGame(432)
+				_ = store.getGames()
+				_, _, _ = store.getCategories(432)
+				_ = store.categoryGames()
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(stop)
+	writers.Wait()
+}
+
+func TestMetadataLoadCategoriesSharesFetch(t *testing.T) {
+	store := newMetadataStore()
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	store.fetch = func(gameId uint, ctx context.Context) ([]Category, error) {
+		fetches.Add(1)
+		<-release
+		return []Category{{Id: 1, Name: "Mods"}}, nil
+	}
+
+	const callers = 20
+	started := &sync.WaitGroup{}
+	done := &sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			started.Done()
+			categories, err := store.loadCategories(432, context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(categories) != 1 {
+				t.Errorf("expected 1 category, got %d", len(categories))
+			}
+		}()
+	}
+
+	//give every caller the chance to join the fetch before it finishes
+	started.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %d", n)
+	}
+}
+
+func TestMetadataLoadCategoriesKeepsFetchAfterCancel(t *testing.T) {
+	store := newMetadataStore()
+	store.fetch = func(gameId uint, ctx context.Context) ([]Category, error) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []Category{{Id: 1}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.loadCategories(432, ctx); err != nil {
+		t.Errorf("expected the fetch to ignore the cancelled caller, got %s", err)
+	}
+}
+
+func TestMetadataCategoriesExpire(t *testing.T) {
+	store := newMetadataStore()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time {
+		return now
+	}
+
+	var fetches atomic.Int32
+	store.fetch = func(gameId uint, ctx context.Context) ([]Category, error) {
+		fetches.Add(1)
+		return []Category{{Id: uint(fetches.Load())}}, nil
+	}
+
+	if _, exists, _ := store.getCategories(432); exists {
+		t.Fatal("expected no categories before loading")
+	}
+
+	_, err := store.loadCategories(432, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(CategoryTTL - time.Second)
+	if _, exists, fresh := store.getCategories(432); !exists || !fresh {
+		t.Errorf("expected fresh categories before the TTL, got exists %v fresh %v", exists, fresh)
+	}
+
+	now = now.Add(time.Second)
+	categories, exists, fresh := store.getCategories(432)
+	if !exists || fresh {
+		t.Errorf("expected stale categories after the TTL, got exists %v fresh %v", exists, fresh)
+	}
+	if len(categories) != 1 || categories[0].Id != 1 {
+		t.Errorf("expected the stale categories to still be given, got %v", categories)
+	}
+
+	store.fetch = func(gameId uint, ctx context.Context) ([]Category, error) {
+		return nil, errors.New("unavailable")
+	}
+	if _, err = store.loadCategories(432, context.Background()); err == nil {
+		t.Error("expected the failed refresh to give an error")
+	}
+	if categories, exists, _ = store.getCategories(432); !exists || categories[0].Id != 1 {
+		t.Error("expected a failed refresh to keep the old categories")
+	}
+}
@@ -0,0 +1,22 @@
+package curseforge
+
+import "strings"
+
+func GetModLoaderType(name string) int {
+	switch strings.ToLower(name) {
+	case "forge":
+		return 1
+	case "cauldron":
+		return 2
+	case "liteloader":
+		return 3
+	case "fabric":
+		return 4
+	case "quilt":
+		return 5
+	case "neoforge":
+		return 6
+	default:
+		return 0
+	}
+}
@@ -18,6 +18,12 @@ type Addon struct {
 	DateCreated       time.Time
 	DateModified      time.Time
 	DateReleased      time.Time
+	ClassId           uint
+	MainFileId        uint
+	IsFeatured        bool
+	Rating            float64
+	//nil when the author hasn't said either way
+	AllowModDistribution *bool
 }
 
 type Links struct {
@@ -43,6 +49,7 @@ type Attachment struct {
 
 type File struct {
 	Id              uint
+	ModId           uint
 	IsAvailable     bool
 	DisplayName     string
 	FileName        string
@@ -54,6 +61,20 @@ type File struct {
 	DownloadUrl     string
 	AlternateFileId uint
 	GameVersions    []string
+	Dependencies    []FileDependency
+
+	SortableGameVersions []SortableGameVersion
+}
+
+type SortableGameVersion struct {
+	GameVersionName   string
+	GameVersion       string
+	GameVersionTypeId uint
+}
+
+type FileDependency struct {
+	ModId        uint
+	RelationType int
 }
 
 type Category struct {
@@ -62,6 +83,7 @@ type Category struct {
 	ParentCategoryId uint
 	Slug             string
 	ClassId          uint
+	IsClass          bool
 }
 
 type Game struct {
@@ -70,6 +92,27 @@ type Game struct {
 	Slug string
 }
 
+type ModsRequest struct {
+	ModIds []uint `json:"modIds"`
+}
+
+type FilesRequest struct {
+	FileIds []uint `json:"fileIds"`
+}
+
+type SearchRequest struct {
+	GameId        uint
+	ClassId       uint
+	CategoryId    uint
+	SearchFilter  string
+	GameVersion   string
+	ModLoaderType int
+	SortField     int
+	SortOrder     string
+	Index         int
+	PageSize      int
+}
+
 type Pagination struct {
 	Index       int
 	PageSize    int
@@ -0,0 +1,20 @@
+package curseforge
+
+func GetRelationType(i int) string {
+	switch i {
+	case 1:
+		return "embedded"
+	case 2:
+		return "optional"
+	case 3:
+		return "required"
+	case 4:
+		return "tool"
+	case 5:
+		return "incompatible"
+	case 6:
+		return "include"
+	default:
+		return "unknown"
+	}
+}
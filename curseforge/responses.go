@@ -12,6 +12,11 @@ type ProjectResponse struct {
 	Data Addon
 }
 
+type ProjectsResponse struct {
+	Response
+	Data []Addon
+}
+
 type SearchResponse struct {
 	PagedResponse
 	Data []Addon
@@ -27,6 +32,11 @@ type FilesResponse struct {
 	Data []File
 }
 
+type FileListResponse struct {
+	Response
+	Data []File
+}
+
 type GameResponse struct {
 	PagedResponse
 	Data []Game
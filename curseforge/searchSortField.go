@@ -0,0 +1,26 @@
+package curseforge
+
+import "strings"
+
+func GetSearchSortField(name string) int {
+	switch strings.ToLower(name) {
+	case "featured":
+		return 1
+	case "popularity":
+		return 2
+	case "updated":
+		return 3
+	case "name":
+		return 4
+	case "author":
+		return 5
+	case "downloads":
+		return 6
+	case "category":
+		return 7
+	case "version":
+		return 8
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,199 @@
+package curseforge
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cfwidget/cfwidget/env"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MaxThumbnailBytes  = 8 << 20
+	MaxThumbnailPixels = 4096 * 4096
+
+	thumbnailTimeout = 10 * time.Second
+	thumbnailTtl     = time.Hour
+)
+
+var ThumbnailTooLargeError = errors.New("thumbnail too large")
+var InvalidThumbnailError = errors.New("thumbnail is not an image")
+
+var thumbnails = newThumbnailCache(int64(env.GetIntOr("THUMBNAIL_CACHE_MB", 64)) << 20)
+
+type cachedThumbnail struct {
+	Url          string
+	Image        image.Image
+	ETag         string
+	LastModified string
+	CheckedAt    time.Time
+	Size         int64
+}
+
+// thumbnailCache is a LRU of decoded thumbnails, bounded by the decoded size of the images it holds
+type thumbnailCache struct {
+	lock     sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	size     int64
+	maxBytes int64
+}
+
+func newThumbnailCache(maxBytes int64) *thumbnailCache {
+	return &thumbnailCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+	}
+}
+
+func (cache *thumbnailCache) get(url string) *cachedThumbnail {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	e, exists := cache.entries[url]
+	if !exists {
+		return nil
+	}
+	cache.order.MoveToFront(e)
+	return e.Value.(*cachedThumbnail)
+}
+
+func (cache *thumbnailCache) set(thumb *cachedThumbnail) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if e, exists := cache.entries[thumb.Url]; exists {
+		cache.size -= e.Value.(*cachedThumbnail).Size
+		cache.order.Remove(e)
+		delete(cache.entries, thumb.Url)
+	}
+
+	//never store something which would evict everything else
+	if thumb.Size > cache.maxBytes {
+		return
+	}
+
+	cache.entries[thumb.Url] = cache.order.PushFront(thumb)
+	cache.size += thumb.Size
+
+	for cache.size > cache.maxBytes {
+		last := cache.order.Back()
+		if last == nil {
+			break
+		}
+		old := cache.order.Remove(last).(*cachedThumbnail)
+		delete(cache.entries, old.Url)
+		cache.size -= old.Size
+	}
+}
+
+func GetThumbnail(url string, ctx context.Context) (image.Image, error) {
+	cached := thumbnails.get(url)
+	if cached != nil && time.Since(cached.CheckedAt) < thumbnailTtl {
+		return cached.Image, nil
+	}
+
+	thumb, err := fetchThumbnail(url, cached, ctx)
+	if err != nil {
+		//if we can't revalidate, what we have is still better than nothing
+		if cached != nil && !errors.Is(err, ThumbnailTooLargeError) && !errors.Is(err, InvalidThumbnailError) {
+			return cached.Image, nil
+		}
+		return nil, err
+	}
+
+	thumbnails.set(thumb)
+	return thumb.Image, nil
+}
+
+func fetchThumbnail(url string, cached *cachedThumbnail, ctx context.Context) (*cachedThumbnail, error) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			request.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed := *cached
+		refreshed.CheckedAt = time.Now()
+		return &refreshed, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("invalid status code: %s", response.Status))
+	}
+
+	if response.ContentLength > MaxThumbnailBytes {
+		return nil, ThumbnailTooLargeError
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, MaxThumbnailBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxThumbnailBytes {
+		return nil, ThumbnailTooLargeError
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, InvalidThumbnailError
+	}
+
+	//check the dimensions before decoding, so a tiny file can't expand into gigabytes of pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxThumbnailPixels {
+		return nil, ThumbnailTooLargeError
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedThumbnail{
+		Url:          url,
+		Image:        img,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		CheckedAt:    time.Now(),
+		Size:         int64(config.Width) * int64(config.Height) * 4,
+	}, nil
+}
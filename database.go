@@ -3,9 +3,10 @@ package main
 import (
 	"fmt"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/cfwidget/cfwidget/widget"
 	"github.com/go-gormigrate/gormigrate/v2"
-	mysql "go.elastic.co/apm/module/apmgormv2/v2/driver/mysql"
 	"gorm.io/gorm"
 	"log"
 	"sync"
@@ -27,11 +28,19 @@ func GetDatabase() (*gorm.DB, error) {
 		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", env.Get("DB_USER"), env.Get("DB_PASS"), env.Get("DB_HOST"), env.Get("DB_DATABASE"))
 
 		log.Printf("Connecting to database: %s\n", env.Get("DB_HOST"))
-		db, err := gorm.Open(mysql.Open(dsn))
+		dialector, plugin := tracing.OpenDatabase(dsn)
+		db, err := gorm.Open(dialector)
 		if err != nil {
 			log.Printf("Error connecting to database: %s", err.Error())
 			return nil, err
 		}
+		if plugin != nil {
+			err = db.Use(plugin)
+			if err != nil {
+				log.Printf("Error connecting to database: %s", err.Error())
+				return nil, err
+			}
+		}
 		sqlDB, err := db.DB()
 		if err != nil {
 			log.Printf("Error connecting to database: %s", err.Error())
@@ -103,6 +112,15 @@ func GetDatabase() (*gorm.DB, error) {
 					return nil
 				},
 			},
+			{
+				ID: "1792368000",
+				Migrate: func(g *gorm.DB) error {
+					return g.AutoMigrate(&widget.ApiKey{}, &widget.ApiKeyUsage{})
+				},
+				Rollback: func(g *gorm.DB) error {
+					return g.Migrator().DropTable(&widget.ApiKeyUsage{}, &widget.ApiKey{})
+				},
+			},
 		})
 
 		err = migrator.Migrate()
@@ -113,6 +131,8 @@ func GetDatabase() (*gorm.DB, error) {
 		log.Printf("Migrations complete")
 
 		_db = db
+		//only once the connection is kept, as a failed attempt is retried on the next call
+		metrics.RegisterDatabase(env.Get("DB_DATABASE"), sqlDB)
 	}
 
 	return _db, nil
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// MaxDependencyDepth limits how far down required dependencies are followed
+const MaxDependencyDepth = 3
+
+type DependencyNode struct {
+	Id           uint                `json:"id" openapi:"required"`
+	Title        string              `json:"title" openapi:"required"`
+	Type         string              `json:"type,omitempty"`
+	Throttled    bool                `json:"throttled,omitempty"`
+	File         *widget.ProjectFile `json:"file,omitempty"`
+	Dependencies []*DependencyNode   `json:"dependencies"`
+}
+
+// getDependencies handles dependencies for a project which has already been resolved
+func getDependencies(c *gin.Context, properties *widget.ProjectProperties) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	versionRequest := c.Query("version")
+	loader := c.Query("loader")
+
+	root := &DependencyNode{
+		Id:           properties.Id,
+		Title:        properties.Title,
+		File:         selectDownload(properties, versionRequest, loader),
+		Dependencies: make([]*DependencyNode, 0),
+	}
+
+	complete, err := buildDependencyTree(root, versionRequest, loader, c.Request.Context())
+	var rateLimitErr RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		abortRateLimited(c, rateLimitErr.RetryAfter)
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	//a tree with throttled projects in it is only good for this request
+	if complete {
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", root)
+		cacheHeaders(c, cacheExpireTime)
+	}
+	c.JSON(http.StatusOK, root)
+	c.Abort()
+}
+
+// buildDependencyTree fills in the tree a level at a time, so each level is one lookup.
+// Everything is listed under the root, but only required dependencies are followed further, and each project is only
+// expanded the first time it's seen.
+// Projects the client's CurseForge budget didn't stretch to are marked as throttled, and the tree isn't complete. When
+// none of the dependencies could be looked up, the rate limit is given as the error instead.
+func buildDependencyTree(root *DependencyNode, versionRequest, loader string, ctx context.Context) (bool, error) {
+	expanded := map[uint]bool{root.Id: true}
+	level := []*DependencyNode{root}
+	found := 0
+	var rateLimited *RateLimitError
+
+	for depth := 0; depth < MaxDependencyDepth && len(level) > 0; depth++ {
+		children := make([]*DependencyNode, 0)
+		ids := make([]uint, 0)
+		for _, node := range level {
+			if node.File == nil {
+				continue
+			}
+			for _, dep := range node.File.Dependencies {
+				if depth > 0 && dep.Type != "required" {
+					continue
+				}
+				child := &DependencyNode{
+					Id:           dep.Id,
+					Title:        dep.Title,
+					Type:         dep.Type,
+					Dependencies: make([]*DependencyNode, 0),
+				}
+				node.Dependencies = append(node.Dependencies, child)
+				children = append(children, child)
+				ids = append(ids, dep.Id)
+			}
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		projects, throttled, err := getBatchProjects(ids, ctx)
+		if err != nil {
+			return false, err
+		}
+
+		next := make([]*DependencyNode, 0)
+		for _, child := range children {
+			if rateLimitErr, exists := throttled[child.Id]; exists {
+				child.Throttled = true
+				rateLimited = &rateLimitErr
+				continue
+			}
+			found++
+
+			project, exists := projects[child.Id]
+			if !exists || project.ParsedProjects == nil {
+				continue
+			}
+			child.Title = project.ParsedProjects.Title
+			child.File = selectDownload(project.ParsedProjects, versionRequest, loader)
+
+			if child.Type == "required" && !expanded[child.Id] {
+				expanded[child.Id] = true
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+
+	if rateLimited != nil && found == 0 {
+		return false, *rateLimited
+	}
+	return rateLimited == nil, nil
+}
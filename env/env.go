@@ -46,6 +46,14 @@ func GetInt(key string) int {
 	return cast.ToInt(Get(key))
 }
 
+func GetIntOr(key string, def int) int {
+	res := Get(key)
+	if res == "" {
+		return def
+	}
+	return cast.ToInt(res)
+}
+
 func readSecret(file string) (string, error) {
 	f, err := os.Open(file)
 	if err != nil {
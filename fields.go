@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"reflect"
+	"strings"
+)
+
+// fieldSelection is what the fields and exclude parameters ask for, an empty selection leaves responses as they are
+type fieldSelection struct {
+	fields  []string
+	exclude []string
+}
+
+func getFieldSelection(c *gin.Context) fieldSelection {
+	return fieldSelection{
+		fields:  splitFieldList(c.Query("fields")),
+		exclude: splitFieldList(c.Query("exclude")),
+	}
+}
+
+func splitFieldList(list string) []string {
+	result := make([]string, 0)
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (s fieldSelection) empty() bool {
+	return len(s.fields) == 0 && len(s.exclude) == 0
+}
+
+// apply slims down a struct to the selected top level fields, named by their JSON names.
+// Slices are applied to each item, and anything else is given back as it is.
+func (s fieldSelection) apply(value interface{}) interface{} {
+	if s.empty() || value == nil {
+		return value
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return value
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, s.apply(v.Index(i).Interface()))
+		}
+		return result
+	case reflect.Struct:
+	default:
+		return value
+	}
+
+	result := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+		if tag := field.Tag.Get("json"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			omitEmpty = contains("omitempty", parts[1:])
+		}
+
+		if len(s.fields) > 0 && !contains(name, s.fields) {
+			continue
+		}
+		if contains(name, s.exclude) {
+			continue
+		}
+
+		fieldValue := v.Field(i)
+		if omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		result[name] = fieldValue.Interface()
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFilesPageSize = 20
+	MaxFilesPageSize     = 100
+)
+
+type FilesResponse struct {
+	Data       []widget.ProjectFile `json:"data" openapi:"required"`
+	Pagination Pagination           `json:"pagination" openapi:"required"`
+}
+
+// getFiles handles files for a project which has already been resolved, filtering what was synced
+func getFiles(c *gin.Context, properties *widget.ProjectProperties) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	page := cast.ToInt(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := cast.ToInt(c.DefaultQuery("per_page", cast.ToString(DefaultFilesPageSize)))
+	if perPage < 1 || perPage > MaxFilesPageSize {
+		perPage = DefaultFilesPageSize
+	}
+
+	from, err := parseFileDate(c.Query("from"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "from must be a date or time"})
+		return
+	}
+	to, err := parseFileDate(c.Query("to"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "to must be a date or time"})
+		return
+	}
+	//a date on its own includes the whole day
+	if len(c.Query("to")) == len(time.DateOnly) {
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	types := splitFieldList(c.Query("type"))
+	loader := c.Query("loader")
+	versionRequest := c.Query("version")
+	versionRange, isRange := widget.ParseVersionRange(versionRequest)
+
+	files := make([]widget.ProjectFile, 0)
+	for _, v := range loaderFiles(properties, loader) {
+		if !loaderMatches(loader, v) {
+			continue
+		}
+		if len(types) > 0 && !contains(v.Type, types) {
+			continue
+		}
+		if versionRequest != "" {
+			if isRange && !versionRange.MatchesAny(fileGameVersions(v)) {
+				continue
+			}
+			if !isRange && !contains(versionRequest, fileGameVersions(v)) {
+				continue
+			}
+		}
+		if !from.IsZero() && v.UploadedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && v.UploadedAt.After(to) {
+			continue
+		}
+		files = append(files, v)
+	}
+
+	ascending := strings.ToLower(c.Query("order")) == "asc"
+	byDownloads := c.Query("sort") == "downloads"
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if !ascending {
+			a, b = b, a
+		}
+		if byDownloads && a.Downloads != b.Downloads {
+			return a.Downloads < b.Downloads
+		}
+		return a.UploadedAt.Before(b.UploadedAt)
+	})
+
+	response := FilesResponse{
+		Data: make([]widget.ProjectFile, 0),
+		Pagination: Pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   len(files),
+		},
+	}
+	if start := (page - 1) * perPage; start < len(files) {
+		response.Data = files[start:min(start+perPage, len(files))]
+	}
+
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", response)
+	cacheHeaders(c, cacheExpireTime)
+	c.JSON(http.StatusOK, response)
+	c.Abort()
+}
+
+// parseFileDate accepts either a full time or just a date, with nothing given being the zero time
+func parseFileDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const GamesPath = "games"
+
+type GameResponse struct {
+	Id   uint   `json:"id" openapi:"required"`
+	Name string `json:"name" openapi:"required"`
+	Slug string `json:"slug" openapi:"required"`
+}
+
+type CategoryResponse struct {
+	Id       uint                `json:"id" openapi:"required"`
+	Name     string              `json:"name" openapi:"required"`
+	Slug     string              `json:"slug" openapi:"required"`
+	IsClass  bool                `json:"is_class"`
+	Children []*CategoryResponse `json:"children"`
+}
+
+// isGamesPath matches both games and games/{slug}/categories
+func isGamesPath(path string) bool {
+	if path == GamesPath {
+		return true
+	}
+	parts := strings.Split(path, "/")
+	return len(parts) == 3 && parts[0] == GamesPath && parts[2] == "categories"
+}
+
+func GetGames(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(c.Param("projectPath"), "/")
+	path = strings.TrimSuffix(path, ".json")
+	if path == GamesPath {
+		games := make([]GameResponse, 0)
+		for _, v := range curseforge.GetGames() {
+			games = append(games, GameResponse{Id: v.Id, Name: v.Name, Slug: v.Slug})
+		}
+
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", games)
+		cacheHeaders(c, cacheExpireTime)
+		c.JSON(http.StatusOK, games)
+		c.Abort()
+		return
+	}
+
+	game := curseforge.GetGameBySlug(strings.Split(path, "/")[1])
+	if game.Id == 0 {
+		SetInCache(c.Request.Host, cacheKey(c), http.StatusNotFound, "", nil)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	categories, err := curseforge.GetCategories(game.Id, c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	tree := buildCategoryTree(categories)
+
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", tree)
+	cacheHeaders(c, cacheExpireTime)
+	c.JSON(http.StatusOK, tree)
+	c.Abort()
+}
+
+// buildCategoryTree nests categories under their parent, anything with an unknown parent is treated as a root
+func buildCategoryTree(categories []curseforge.Category) []*CategoryResponse {
+	sorted := make([]curseforge.Category, len(categories))
+	copy(sorted, categories)
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+
+	nodes := make(map[uint]*CategoryResponse)
+	for _, v := range sorted {
+		nodes[v.Id] = &CategoryResponse{
+			Id:       v.Id,
+			Name:     v.Name,
+			Slug:     v.Slug,
+			IsClass:  v.IsClass,
+			Children: make([]*CategoryResponse, 0),
+		}
+	}
+
+	roots := make([]*CategoryResponse, 0)
+	for _, v := range sorted {
+		node := nodes[v.Id]
+		if parent, exists := nodes[v.ParentCategoryId]; exists && v.ParentCategoryId != v.Id {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"strings"
+	"time"
+)
+
+var supportedLanguages = []language.Tag{
+	language.English,
+	language.German,
+	language.BrazilianPortuguese,
+}
+
+var languageMatcher = language.NewMatcher(supportedLanguages)
+
+// translations are keyed by the English text, so anything missing falls back to English
+var translations = map[language.Tag]map[string]string{
+	language.German: {
+		"by %s":                             "von %s",
+		"Latest v%s File:":                  "Neueste v%s-Datei:",
+		"alpha!":                            "Alpha!",
+		"beta!":                             "Beta!",
+		"%s Downloads":                      "%s Downloads",
+		"Uploaded %s":                       "Hochgeladen am %s",
+		"Download for %s":                   "Download für %s",
+		"View all %d downloads":             "Alle %d Downloads anzeigen",
+		"View Project (no files available)": "Projekt ansehen (keine Dateien verfügbar)",
+		"Learn more about widget":           "Mehr über das Widget erfahren",
+		"Latest File:":                      "Neueste Datei:",
+		"For:":                              "Für:",
+		"Downloads:":                        "Downloads:",
+		"Uploaded:":                         "Hochgeladen:",
+		"%d Projects":                       "%d Projekte",
+		"Updated %s":                        "Aktualisiert am %s",
+		"No projects found":                 "Keine Projekte gefunden",
+		"Changelog:":                        "Änderungen:",
+		"Wiki":                              "Wiki",
+		"Issues":                            "Fehlerberichte",
+		"Source":                            "Quellcode",
+	},
+	language.BrazilianPortuguese: {
+		"by %s":                             "por %s",
+		"Latest v%s File:":                  "Arquivo mais recente v%s:",
+		"alpha!":                            "alfa!",
+		"beta!":                             "beta!",
+		"%s Downloads":                      "%s downloads",
+		"Uploaded %s":                       "Enviado em %s",
+		"Download for %s":                   "Baixar para %s",
+		"View all %d downloads":             "Ver todos os %d downloads",
+		"View Project (no files available)": "Ver projeto (nenhum arquivo disponível)",
+		"Learn more about widget":           "Saiba mais sobre o widget",
+		"Latest File:":                      "Arquivo mais recente:",
+		"For:":                              "Para:",
+		"Downloads:":                        "Downloads:",
+		"Uploaded:":                         "Enviado:",
+		"%d Projects":                       "%d projetos",
+		"Updated %s":                        "Atualizado em %s",
+		"No projects found":                 "Nenhum projeto encontrado",
+		"Changelog:":                        "Alterações:",
+		"Wiki":                              "Wiki",
+		"Issues":                            "Problemas",
+		"Source":                            "Código-fonte",
+	},
+}
+
+// dateLayouts use the English month name, which is swapped for the translated one after formatting
+var dateLayouts = map[language.Tag]string{
+	language.English:             "January 02 2006, 03:04pm",
+	language.German:              "02. January 2006, 15:04",
+	language.BrazilianPortuguese: "02 de January de 2006, 15:04",
+}
+
+var monthNames = map[language.Tag][]string{
+	language.German:              {"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	language.BrazilianPortuguese: {"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+}
+
+var messageCatalog = buildCatalog()
+
+type Localizer struct {
+	Tag     language.Tag
+	printer *message.Printer
+}
+
+func buildCatalog() catalog.Catalog {
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	for tag, messages := range translations {
+		for key, msg := range messages {
+			if err := builder.SetString(tag, key, msg); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return builder
+}
+
+func NewLocalizer(tag language.Tag) Localizer {
+	return Localizer{
+		Tag:     tag,
+		printer: message.NewPrinter(tag, message.Catalog(messageCatalog)),
+	}
+}
+
+// requestLanguage picks the language from the lang parameter, then the browser's Accept-Language
+func requestLanguage(c *gin.Context) language.Tag {
+	_, index := language.MatchStrings(languageMatcher, c.Query("lang"), c.GetHeader("Accept-Language"))
+	return supportedLanguages[index]
+}
+
+func (l Localizer) T(key string, args ...interface{}) string {
+	return l.getPrinter().Sprintf(key, args...)
+}
+
+func (l Localizer) Number(n interface{}) string {
+	return l.getPrinter().Sprintf("%d", n)
+}
+
+func (l Localizer) Date(t time.Time) string {
+	layout, exists := dateLayouts[l.Tag]
+	if !exists {
+		layout = dateLayouts[language.English]
+	}
+
+	result := t.Format(layout)
+	if names, exists := monthNames[l.Tag]; exists {
+		result = strings.Replace(result, t.Month().String(), names[t.Month()-1], 1)
+	}
+	return result
+}
+
+func (l Localizer) Lang() string {
+	return l.Tag.String()
+}
+
+// getPrinter lets the zero value Localizer be used as English
+func (l Localizer) getPrinter() *message.Printer {
+	if l.printer == nil {
+		return message.NewPrinter(language.English, message.Catalog(messageCatalog))
+	}
+	return l.printer
+}
@@ -4,21 +4,57 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"errors"
 	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/cfwidget/cfwidget/widget"
+	"github.com/chai2010/webp"
 	"github.com/golang/freetype/truetype"
-	"go.elastic.co/apm/v2"
+	"github.com/spf13/cast"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
 	"math"
+	"mime"
+	"strings"
 )
 
 const ThumbnailSize = 256
 
+// AuthorImageProjects is how many of the most recently updated projects are drawn on an author card
+const AuthorImageProjects = 5
+
+const (
+	FormatPng  = "png"
+	FormatJpeg = "jpeg"
+	FormatWebp = "webp"
+
+	//NegotiatedImageExtension picks the format from the Accept header instead of the path
+	NegotiatedImageExtension = ".img"
+)
+
+var imageExtensions = map[string]string{
+	".png":  FormatPng,
+	".jpg":  FormatJpeg,
+	".jpeg": FormatJpeg,
+	".webp": FormatWebp,
+}
+
+var imageContentTypes = map[string]string{
+	FormatPng:  "image/png",
+	FormatJpeg: "image/jpeg",
+	FormatWebp: "image/webp",
+}
+
+var defaultImageQuality = map[string]int{
+	FormatJpeg: 90,
+	FormatWebp: 80,
+}
+
 var (
 	//dpi              = flag.Float64("dpi", 72, "screen resolution in Dots Per Inch")
 	//size             = flag.Float64("size", 16, "font size in points")
@@ -41,9 +77,63 @@ type ImageRequest struct {
 	DarkMode    bool
 	Transparent bool
 	NoThumbnail bool
+	Format      string
+	Quality     int
+	Localizer   Localizer
 }
 
 func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx context.Context) ([]byte, error) {
+	finalImage, err := renderProjectCard(project, request, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := new(bytes.Buffer)
+	err = encodeImage(output, finalImage, request)
+	return output.Bytes(), err
+}
+
+// generateCollectionImage lays the project cards out in a grid, filling each row before starting the next
+func generateCollectionImage(projects []*widget.ProjectProperties, columns int, request ImageRequest, ctx context.Context) ([]byte, error) {
+	cards := make([]*image.RGBA, 0, len(projects))
+	for _, v := range projects {
+		//cards are built around the latest file, so there is nothing to draw without one
+		if v.Download == nil {
+			continue
+		}
+
+		card, err := renderProjectCard(v, request, ctx)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+
+	if len(cards) == 0 {
+		return nil, errors.New("no projects to render")
+	}
+
+	if columns < 1 {
+		columns = 1
+	}
+	if columns > len(cards) {
+		columns = len(cards)
+	}
+	rows := (len(cards) + columns - 1) / columns
+
+	cardSize := cards[0].Bounds().Size()
+	finalImage := image.NewRGBA(image.Rect(0, 0, cardSize.X*columns, cardSize.Y*rows))
+	for i, card := range cards {
+		offset := image.Point{X: (i % columns) * cardSize.X, Y: (i / columns) * cardSize.Y}
+		draw.Draw(finalImage, card.Bounds().Add(offset), card, image.Point{X: 0, Y: 0}, draw.Src)
+	}
+
+	output := new(bytes.Buffer)
+	err := encodeImage(output, finalImage, request)
+	return output.Bytes(), err
+}
+
+func renderProjectCard(project *widget.ProjectProperties, request ImageRequest, ctx context.Context) (*image.RGBA, error) {
 	thumbnailSize := ThumbnailSize
 
 	var thumbnail image.Image
@@ -57,7 +147,7 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		}
 	}
 
-	span, _ := apm.StartSpan(ctx, "generateImage", "custom")
+	span, _ := tracing.StartSpan(ctx, "generateImage", "custom")
 	defer span.End()
 
 	gameName := project.Game
@@ -66,6 +156,7 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		gameName = game.Name
 	}
 
+	l := request.Localizer
 	text := []Text{
 		{
 			Font: boldFont,
@@ -73,12 +164,12 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		},
 		{
 			Font:    standardFont,
-			Text:    " by " + project.Members[0].Username,
+			Text:    " " + l.T("by %s", project.Members[0].Username),
 			EndLine: true,
 		},
 		{
 			Font: boldFont,
-			Text: "Latest File:",
+			Text: l.T("Latest File:"),
 		},
 		{
 			Font:    standardFont,
@@ -87,7 +178,7 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		},
 		{
 			Font: boldFont,
-			Text: "For:",
+			Text: l.T("For:"),
 		},
 		{
 			Font:    standardFont,
@@ -96,26 +187,24 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		},
 		{
 			Font: boldFont,
-			Text: "Downloads:",
+			Text: l.T("Downloads:"),
 		},
 		{
 			Font:    standardFont,
-			Text:    " " + messagePrinter.Sprintf("%d", project.Downloads["total"]),
+			Text:    " " + l.Number(project.Downloads["total"]),
 			EndLine: true,
 		},
 		{
 			Font: boldFont,
-			Text: "Uploaded:",
+			Text: l.T("Uploaded:"),
 		},
 		{
 			Font:    standardFont,
-			Text:    " " + project.Download.UploadedAt.Format("January 02 2006, 03:04pm") + " UTC",
+			Text:    " " + l.Date(project.Download.UploadedAt) + " UTC",
 			EndLine: true,
 		},
 	}
 
-	output := new(bytes.Buffer)
-
 	//prepare white box as final result
 	imageXSize := 928 + thumbnailPadding
 	imageYSize := ThumbnailSize //use original size for our heights
@@ -131,7 +220,8 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		bgColor = image.Black
 	}
 
-	if !request.Transparent {
+	//jpeg has no alpha channel, so there is nothing to be transparent with
+	if !request.Transparent || request.Format == FormatJpeg {
 		draw.Draw(finalImage, finalImage.Bounds(), bgColor, image.Point{X: 0, Y: 0}, draw.Src)
 		draw.Draw(finalImage, image.Rect(0, 0, (thumbnailPadding*2)+thumbnailSize, (thumbnailPadding*2)+thumbnailSize), bgColor, image.Point{X: 0, Y: 0}, draw.Src)
 	}
@@ -169,10 +259,165 @@ func generateImage(project *widget.ProjectProperties, request ImageRequest, ctx
 		}
 	}
 
-	err = png.Encode(output, finalImage)
+	return finalImage, nil
+}
+
+func generateAuthorImage(author *widget.Author, projects []*widget.ProjectProperties, downloads uint64, request ImageRequest, ctx context.Context) ([]byte, error) {
+	if len(projects) > AuthorImageProjects {
+		projects = projects[:AuthorImageProjects]
+	}
+
+	//fetch thumbnails before the span, so it only covers the drawing like generateImage
+	thumbnails := make([]image.Image, len(projects))
+	if !request.NoThumbnail {
+		for i, v := range projects {
+			thumbnail, err := curseforge.GetThumbnail(v.Thumbnail, ctx)
+			if err != nil {
+				return nil, err
+			}
+			thumbnails[i] = thumbnail
+		}
+	}
+
+	span, _ := tracing.StartSpan(ctx, "generateAuthorImage", "custom")
+	defer span.End()
+
+	l := request.Localizer
+	lineHeight := int(math.Ceil(size * spacing * dpi / 72))
+	baseline := 10 + int(math.Ceil(size*dpi/72))
+	rowHeight := lineHeight * 2
+	rowThumbnailSize := rowHeight - (thumbnailPadding * 2)
+
+	imageXSize := 928 + ThumbnailSize + (thumbnailPadding * 2)
+	imageYSize := lineHeight + (rowHeight * len(projects)) + (thumbnailPadding * 2)
+
+	finalImage := image.NewRGBA(image.Rect(0, 0, imageXSize, imageYSize))
+
+	bgColor := image.White
+	if request.DarkMode {
+		bgColor = image.Black
+	}
+
+	if !request.Transparent || request.Format == FormatJpeg {
+		draw.Draw(finalImage, finalImage.Bounds(), bgColor, image.Point{X: 0, Y: 0}, draw.Src)
+	}
+
+	d := &font.Drawer{
+		Dst: finalImage,
+		Src: image.Black,
+	}
+
+	if request.DarkMode {
+		d.Src = image.White
+	}
+
+	drawLine(d, thumbnailPadding, baseline, []Text{
+		{
+			Font: boldFont,
+			Text: author.Username,
+		},
+		{
+			Font: standardFont,
+			Text: " - " + l.T("%d Projects", len(author.ParsedProjects.Projects)) + ", " + l.T("%s Downloads", l.Number(downloads)),
+		},
+	})
+
+	for i, v := range projects {
+		top := thumbnailPadding + lineHeight + (rowHeight * i)
+
+		textOffset := thumbnailPadding
+		if !request.NoThumbnail {
+			scaled := image.NewRGBA(image.Rect(0, 0, rowThumbnailSize, rowThumbnailSize))
+			draw.BiLinear.Scale(scaled, scaled.Rect, thumbnails[i], thumbnails[i].Bounds(), draw.Over, nil)
+			draw.Draw(finalImage, image.Rect(thumbnailPadding, top+thumbnailPadding, thumbnailPadding+rowThumbnailSize, top+thumbnailPadding+rowThumbnailSize), scaled, image.Point{X: 0, Y: 0}, draw.Over)
+			textOffset = rowThumbnailSize + (thumbnailPadding * 2)
+		}
+
+		drawLine(d, textOffset, top+baseline-thumbnailPadding, []Text{
+			{
+				Font: boldFont,
+				Text: v.Title,
+			},
+			{
+				Font: standardFont,
+				Text: " - " + l.T("%s Downloads", l.Number(v.Downloads["total"])),
+			},
+		})
+
+		if v.Download != nil {
+			drawLine(d, textOffset, top+baseline-thumbnailPadding+lineHeight, []Text{
+				{
+					Font: standardFont,
+					Text: v.Download.Name + " - " + l.Date(v.Download.UploadedAt) + " UTC",
+				},
+			})
+		}
+	}
+
+	output := new(bytes.Buffer)
+	err := encodeImage(output, finalImage, request)
 	return output.Bytes(), err
 }
 
+func drawLine(d *font.Drawer, x, y int, text []Text) {
+	d.Dot = fixed.P(x, y)
+	for _, s := range text {
+		d.Face = s.Font
+		d.DrawString(s.Text)
+	}
+}
+
+func encodeImage(output *bytes.Buffer, img image.Image, request ImageRequest) error {
+	quality := request.Quality
+	if quality <= 0 || quality > 100 {
+		quality = defaultImageQuality[request.Format]
+	}
+
+	switch request.Format {
+	case FormatJpeg:
+		return jpeg.Encode(output, img, &jpeg.Options{Quality: quality})
+	case FormatWebp:
+		return webp.Encode(output, img, &webp.Options{Quality: float32(quality)})
+	default:
+		return png.Encode(output, img)
+	}
+}
+
+// splitImageExtension removes a known image extension from the path, returning the format it asked for
+func splitImageExtension(path string) (string, string, bool) {
+	if strings.HasSuffix(path, NegotiatedImageExtension) {
+		return strings.TrimSuffix(path, NegotiatedImageExtension), "", true
+	}
+
+	for ext, format := range imageExtensions {
+		if strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext), format, true
+		}
+	}
+
+	return path, "", false
+}
+
+// negotiateImageFormat picks the smallest format the client has explicitly said it can display
+func negotiateImageFormat(accept string) string {
+	accepted := make([]string, 0)
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil || params["q"] != "" && cast.ToFloat64(params["q"]) <= 0 {
+			continue
+		}
+		accepted = append(accepted, mediaType)
+	}
+
+	for _, format := range []string{FormatWebp, FormatJpeg} {
+		if contains(imageContentTypes[format], accepted) {
+			return format
+		}
+	}
+
+	return FormatPng
+}
+
 func getFont(fontData []byte) font.Face {
 	parsedFont, err := truetype.Parse(fontData)
 	if err != nil {
@@ -6,28 +6,30 @@ import (
 	"fmt"
 	"github.com/cfwidget/cfwidget/curseforge"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"go.elastic.co/apm/module/apmgin/v2"
-	"go.elastic.co/apm/v2"
 	"golang.org/x/sync/errgroup"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
 var g errgroup.Group
 
-func init() {
+func main() {
+	//checked here rather than in init, so tests can run without a key
 	if env.Get("CORE_KEY") == "" {
 		panic(errors.New("CORE_KEY OR CORE_KEY_FILE MUST BE DEFINED"))
 	}
-}
+	if _, err := getAdminTokens(); err != nil {
+		panic(err)
+	}
 
-func main() {
 	//run actual website
 	webServer := &http.Server{
 		Addr:         ":8080",
@@ -35,13 +37,17 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	//there is a race condition where APM doesn't handle creating "default" right twice
-	_ = apm.DefaultTracer()
-
 	g.Go(func() error {
 		web := gin.New()
-		web.Use(apmgin.Middleware(web))
+		//only take the client IP from the proxy headers when they came from Traefik
+		err := web.SetTrustedProxies(strings.Split(env.GetOr("TRUSTED_PROXIES", "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.1"), ","))
+		if err != nil {
+			return err
+		}
+		web.Use(hideApiKey)
+		web.Use(tracing.Middleware(web))
 		web.Use(gin.Recovery())
+		web.Use(recordMetrics)
 
 		web.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 			if param.Latency > time.Minute {
@@ -61,8 +67,8 @@ func main() {
 
 		web.Use(cors.New(cors.Config{
 			AllowAllOrigins:  true,
-			AllowMethods:     []string{"GET"},
-			AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type"},
+			AllowMethods:     []string{"GET", "POST"},
+			AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "X-API-Key", "Authorization"},
 			AllowCredentials: false,
 			MaxAge:           12 * time.Hour,
 		}))
@@ -71,7 +77,7 @@ func main() {
 		webServer.Handler = web
 
 		log.Printf("Starting web services\n")
-		err := webServer.ListenAndServe()
+		err = webServer.ListenAndServe()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -79,6 +85,7 @@ func main() {
 	})
 
 	curseforge.StartGameCacheSyncer()
+	StartApiKeySyncer()
 
 	go func() {
 		ticker := time.NewTicker(time.Minute)
@@ -98,6 +105,7 @@ func main() {
 	log.Println("Shutting down server...")
 
 	shutdownServer(webServer)
+	shutdownTracing()
 
 	if err := g.Wait(); err != nil {
 		log.Fatal(err)
@@ -111,3 +119,11 @@ func shutdownServer(httpServer *http.Server) {
 		log.Printf("Server forced to shutdown: %s\n", err)
 	}
 }
+
+func shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		log.Printf("Error sending remaining traces: %s\n", err)
+	}
+}
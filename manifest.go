@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MaxManifestSize limits how many files one manifest can resolve
+	MaxManifestSize = 500
+	// MaxManifestBytes limits the size of an uploaded manifest
+	MaxManifestBytes = 2 << 20
+
+	ManifestFileOk      = "ok"
+	ManifestFileMissing = "missing"
+	ManifestFileDeleted = "deleted"
+	// ManifestFileThrottled is for files we couldn't look up, as the client is over their CurseForge budget
+	ManifestFileThrottled = "throttled"
+)
+
+// Manifest is the manifest.json from a CurseForge modpack export
+type Manifest struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Author    string `json:"author"`
+	Minecraft struct {
+		Version    string `json:"version"`
+		ModLoaders []struct {
+			Id string `json:"id"`
+		} `json:"modLoaders"`
+	} `json:"minecraft"`
+	Files []struct {
+		ProjectId uint `json:"projectID"`
+		FileId    uint `json:"fileID"`
+		Required  bool `json:"required"`
+	} `json:"files"`
+}
+
+type ManifestResponse struct {
+	Name        string         `json:"name"`
+	Version     string         `json:"version"`
+	Author      string         `json:"author"`
+	GameVersion string         `json:"game_version"`
+	Loaders     []string       `json:"loaders"`
+	Files       []ManifestFile `json:"files" openapi:"required"`
+}
+
+type ManifestFile struct {
+	ProjectId   uint     `json:"project_id" openapi:"required"`
+	FileId      uint     `json:"file_id" openapi:"required"`
+	Required    bool     `json:"required"`
+	Status      string   `json:"status" openapi:"required"`
+	Title       string   `json:"title,omitempty"`
+	Url         string   `json:"url,omitempty"`
+	Authors     []string `json:"authors"`
+	FileName    string   `json:"file_name,omitempty"`
+	FileSize    uint64   `json:"file_size,omitempty"`
+	DownloadUrl string   `json:"download_url,omitempty"`
+}
+
+func ManifestCall(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	manifest, err := readManifest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	if len(manifest.Files) > MaxManifestSize {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "too many files in manifest"})
+		return
+	}
+
+	response, err := resolveManifest(manifest, c.Request.Context())
+	var rateLimitErr RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		abortRateLimited(c, rateLimitErr.RetryAfter)
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	switch c.Query("format") {
+	case "html":
+		buf := &bytes.Buffer{}
+		_ = templateEngine.ExecuteTemplate(buf, "manifest.tmpl", gin.H{
+			"manifest": response,
+		})
+		c.Data(http.StatusOK, "text/html", buf.Bytes())
+	case "markdown":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(renderManifestMarkdown(response)))
+	default:
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// readManifest accepts the manifest either as a "manifest" file upload or as the request body
+func readManifest(c *gin.Context) (Manifest, error) {
+	var manifest Manifest
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxManifestBytes)
+
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("manifest")
+		if err != nil {
+			return manifest, err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return manifest, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	err := json.NewDecoder(reader).Decode(&manifest)
+	return manifest, err
+}
+
+func resolveManifest(manifest Manifest, ctx context.Context) (ManifestResponse, error) {
+	response := ManifestResponse{
+		Name:        manifest.Name,
+		Version:     manifest.Version,
+		Author:      manifest.Author,
+		GameVersion: manifest.Minecraft.Version,
+		Loaders:     make([]string, 0),
+		Files:       make([]ManifestFile, 0, len(manifest.Files)),
+	}
+
+	for _, v := range manifest.Minecraft.ModLoaders {
+		response.Loaders = append(response.Loaders, v.Id)
+	}
+
+	ids := make([]uint, 0, len(manifest.Files))
+	for _, v := range manifest.Files {
+		ids = append(ids, v.ProjectId)
+	}
+
+	projects, throttled, err := getBatchProjects(ids, ctx)
+	if err != nil {
+		return response, err
+	}
+
+	unknownFiles := make([]uint, 0)
+	for _, v := range manifest.Files {
+		file := ManifestFile{
+			ProjectId: v.ProjectId,
+			FileId:    v.FileId,
+			Required:  v.Required,
+			Status:    ManifestFileMissing,
+			Authors:   make([]string, 0),
+		}
+
+		if _, exists := throttled[v.ProjectId]; exists {
+			//these would otherwise be reported as missing
+			file.Status = ManifestFileThrottled
+		} else if project, exists := projects[v.ProjectId]; exists && project.ParsedProjects != nil {
+			properties := project.ParsedProjects
+			file.Title = properties.Title
+			file.Url = properties.Urls["curseforge"]
+			for _, m := range properties.Members {
+				file.Authors = append(file.Authors, m.Username)
+			}
+
+			for _, f := range properties.Files {
+				if f.Id == v.FileId {
+					file.Status = ManifestFileOk
+					file.FileName = f.Name
+					file.FileSize = f.FileSize
+					file.DownloadUrl = f.DownloadUrl
+					break
+				}
+			}
+		}
+
+		if file.Status == ManifestFileMissing {
+			unknownFiles = append(unknownFiles, v.FileId)
+		}
+
+		response.Files = append(response.Files, file)
+	}
+
+	//anything we couldn't find is either hidden from us, or gone entirely
+	if len(unknownFiles) > 0 {
+		var rateLimitErr RateLimitError
+		if errors.As(allowUpstream(ctx), &rateLimitErr) {
+			for i, v := range response.Files {
+				if v.Status == ManifestFileMissing {
+					response.Files[i].Status = ManifestFileThrottled
+				}
+			}
+			return response, manifestThrottled(response, &rateLimitErr)
+		}
+
+		files, err := curseforge.GetFilesById(unknownFiles, ctx)
+		if err != nil {
+			log.Printf("Error getting manifest files: %s", err)
+			return response, manifestThrottled(response, firstRateLimit(throttled))
+		}
+
+		found := make(map[uint]curseforge.File)
+		for _, v := range files {
+			found[v.Id] = v
+		}
+
+		for i, v := range response.Files {
+			if v.Status != ManifestFileMissing {
+				continue
+			}
+
+			f, exists := found[v.FileId]
+			if !exists {
+				response.Files[i].Status = ManifestFileDeleted
+				continue
+			}
+
+			response.Files[i].FileName = f.FileName
+			response.Files[i].FileSize = f.FileLength
+			if curseforge.IsAllowedFile(f.FileStatus) && v.Title != "" {
+				response.Files[i].Status = ManifestFileOk
+				response.Files[i].DownloadUrl = f.DownloadUrl
+			}
+		}
+	}
+
+	return response, manifestThrottled(response, firstRateLimit(throttled))
+}
+
+// manifestThrottled gives the rate limit when none of the files could be looked up, as then there's nothing to give
+func manifestThrottled(response ManifestResponse, rateLimitErr *RateLimitError) error {
+	if rateLimitErr == nil {
+		return nil
+	}
+	for _, v := range response.Files {
+		if v.Status != ManifestFileThrottled {
+			return nil
+		}
+	}
+	return *rateLimitErr
+}
+
+func renderManifestMarkdown(manifest ManifestResponse) string {
+	builder := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(builder, "# %s %s\n\n", markdownEscape(manifest.Name), markdownEscape(manifest.Version))
+
+	details := make([]string, 0)
+	if manifest.Author != "" {
+		details = append(details, "By "+markdownEscape(manifest.Author))
+	}
+	if manifest.GameVersion != "" {
+		details = append(details, "Minecraft "+markdownEscape(manifest.GameVersion))
+	}
+	if len(manifest.Loaders) > 0 {
+		details = append(details, markdownEscape(strings.Join(manifest.Loaders, ", ")))
+	}
+	if len(details) > 0 {
+		builder.WriteString(strings.Join(details, " - ") + "\n\n")
+	}
+
+	builder.WriteString("| Project | Authors | File | Size | Download |\n")
+	builder.WriteString("| --- | --- | --- | --- | --- |\n")
+
+	for _, v := range manifest.Files {
+		title := coalesce(v.Title, fmt.Sprintf("Project %d", v.ProjectId))
+		if v.Url != "" {
+			title = fmt.Sprintf("[%s](%s)", markdownEscape(title), v.Url)
+		} else {
+			title = markdownEscape(title)
+		}
+
+		fileName := markdownEscape(coalesce(v.FileName, fmt.Sprintf("File %d", v.FileId)))
+		if v.Status != ManifestFileOk {
+			fileName += fmt.Sprintf(" **%s**", v.Status)
+		}
+
+		download := ""
+		if v.DownloadUrl != "" {
+			download = fmt.Sprintf("[Download](%s)", v.DownloadUrl)
+		}
+
+		size := ""
+		if v.FileSize > 0 {
+			size = formatFileSize(v.FileSize)
+		}
+
+		_, _ = fmt.Fprintf(builder, "| %s | %s | %s | %s | %s |\n", title, markdownEscape(strings.Join(v.Authors, ", ")), fileName, size, download)
+	}
+
+	return builder.String()
+}
+
+var markdownReplacer = strings.NewReplacer("\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "`", "\\`", "<", "&lt;", ">", "&gt;", "\n", " ")
+
+func markdownEscape(s string) string {
+	return markdownReplacer.Replace(s)
+}
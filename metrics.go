@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const MetricsPath = "metrics"
+
+// GetMetrics serves the Prometheus metrics, which need a token so they aren't public
+func GetMetrics(c *gin.Context) {
+	requireAdmin(ScopeMetrics)(c)
+	if c.IsAborted() {
+		return
+	}
+
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+func recordMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	metrics.ObserveRequest(requestRoute(c), requestHost(c), c.Request.Method, c.Writer.Status(), time.Since(start))
+}
+
+// requestRoute names what the request was for, as every GET goes through the same gin route
+func requestRoute(c *gin.Context) string {
+	if c.Request.Method != http.MethodGet {
+		if c.FullPath() == "" {
+			return "unknown"
+		}
+		return c.FullPath()
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(c.Param("projectPath"), "/"), ".json")
+	path, _, isImage := splitImageExtension(path)
+
+	switch {
+	case path == "":
+		return "documentation"
+	case path == "favicon.ico" || path == "css/app.css" || path == "service-worker.js" || path == "service-worker-dev.js" || path == "robots.txt":
+		return "static"
+	case path == OpenApiPath || path == MetricsPath || path == CollectionPath || path == SearchPath:
+		return path
+	case path == AdminKeysPath || strings.HasPrefix(path, AdminKeysPath+"/"):
+		return AdminKeysPath
+	case strings.HasPrefix(path, V2Path):
+		resource, _, _ := strings.Cut(strings.TrimPrefix(path, V2Path), "/")
+		return V2Path + resource
+	case isGamesPath(path):
+		return GamesPath
+	case strings.HasPrefix(path, AuthorPath):
+		return strings.TrimSuffix(AuthorPath, "/")
+	}
+
+	if _, resource := splitProjectResource(path); resource != "" {
+		parts := strings.Split(resource, "/")
+		if len(parts) == 3 && parts[2] == "changelog" {
+			return "project/files/changelog"
+		}
+		return "project/" + parts[0]
+	}
+	if isImage {
+		return "project/image"
+	}
+	return "project"
+}
+
+// requestHost labels which side the request was for, rather than using the Host header as given
+func requestHost(c *gin.Context) string {
+	switch c.Request.Host {
+	case env.Get("API_HOSTNAME"):
+		return "api"
+	case env.Get("WEB_HOSTNAME"):
+		return "web"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const namespace = "cfwidget"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests handled, by route, host, method and status.",
+	}, []string{"route", "host", "method", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle requests, by route and host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "host"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Response cache lookups, by whether they were a hit or a miss.",
+	}, []string{"result"})
+
+	curseForgeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "curseforge_requests_total",
+		Help:      "Calls made to CurseForge, by endpoint and status, where a status of 0 is a call which got no response.",
+	}, []string{"endpoint", "status"})
+
+	curseForgeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "curseforge_request_duration_seconds",
+		Help:      "Time taken by calls to CurseForge, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	syncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_total",
+		Help:      "Project and author syncs, by whether they succeeded.",
+	}, []string{"type", "result"})
+)
+
+// idSegment matches the ids in CurseForge paths, so each project doesn't become its own endpoint
+var idSegment = regexp.MustCompile(`/\d+(/|$)`)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveRequest(route, host, method string, status int, duration time.Duration) {
+	requests.WithLabelValues(route, host, method, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(route, host).Observe(duration.Seconds())
+}
+
+func ObserveCache(hit bool) {
+	if hit {
+		cacheRequests.WithLabelValues("hit").Inc()
+	} else {
+		cacheRequests.WithLabelValues("miss").Inc()
+	}
+}
+
+func ObserveCurseForge(path string, status int, duration time.Duration) {
+	endpoint := CurseForgeEndpoint(path)
+	curseForgeRequests.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	curseForgeDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
+
+// CurseForgeEndpoint replaces the ids in a CurseForge path, such as /v1/mods/{id}/files
+func CurseForgeEndpoint(path string) string {
+	//run twice, as matches can't overlap, so /1/2 would only have the first replaced
+	for i := 0; i < 2; i++ {
+		path = idSegment.ReplaceAllString(path, "/{id}$1")
+	}
+	return path
+}
+
+func ObserveSync(kind string, err error) {
+	if err != nil {
+		syncs.WithLabelValues(kind, "failure").Inc()
+	} else {
+		syncs.WithLabelValues(kind, "success").Inc()
+	}
+}
+
+// RegisterCacheSize reports the number of responses in the cache, which is only counted when metrics are collected
+func RegisterCacheSize(size func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_entries",
+		Help:      "Responses held in the cache, including any which have expired but not been removed.",
+	}, func() float64 {
+		return float64(size())
+	})
+}
+
+// RegisterQueueDepth reports how many items are waiting in a queue
+func RegisterQueueDepth(queue string, depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth",
+		Help:        "Items waiting to be processed, by queue.",
+		ConstLabels: prometheus.Labels{"queue": queue},
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// RegisterDatabase reports the connection pool stats for the database
+func RegisterDatabase(name string, db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenApiPath is served as /openapi.json, the .json is trimmed off before we see it
+const OpenApiPath = "openapi"
+
+type openApiObject map[string]interface{}
+
+var openApiSpec openApiObject
+var openApiOnce sync.Once
+
+// openApiParameter is a query parameter, or a path parameter when the name is in braces
+type openApiParameter struct {
+	name        string
+	description string
+	schema      openApiObject
+}
+
+// openApiOperation describes one route, the schemas are built from the types the handlers respond with
+type openApiOperation struct {
+	method      string
+	path        string
+	summary     string
+	web         bool
+	parameters  []openApiParameter
+	request     interface{}
+	response    interface{}
+	contentType string
+	//errorResponse is what the errors are wrapped in, when the route has its own envelope for them
+	errorResponse interface{}
+}
+
+var (
+	stringSchema  = openApiObject{"type": "string"}
+	integerSchema = openApiObject{"type": "integer"}
+)
+
+var projectParameters = []openApiParameter{
+	{name: "version", description: "Game version, version range, release type, file id or latest, used to pick the download", schema: stringSchema},
+	{name: "loader", description: "Only use files for this loader when picking the download", schema: stringSchema},
+}
+
+var fieldParameters = []openApiParameter{
+	{name: "fields", description: "Comma separated fields to include, everything else is left out", schema: stringSchema},
+	{name: "exclude", description: "Comma separated fields to leave out", schema: stringSchema},
+}
+
+var widgetParameters = []openApiParameter{
+	{name: "theme", description: "light, dark or auto", schema: openApiObject{"type": "string", "enum": []string{ThemeLight, ThemeDark, ThemeAuto}}},
+	{name: "background", description: "Background color, named or hex", schema: stringSchema},
+	{name: "text", description: "Text color, named or hex", schema: stringSchema},
+	{name: "link", description: "Link color, named or hex", schema: stringSchema},
+	{name: "button", description: "Button color, named or hex", schema: stringSchema},
+	{name: "accent", description: "Button border and hover color, named or hex", schema: stringSchema},
+	{name: "border", description: "default or none", schema: openApiObject{"type": "string", "enum": []string{"default", "none"}}},
+	{name: "lang", description: "Language of the widget, defaults to the browser's", schema: stringSchema},
+	{name: "changelog", description: "Set to 1 to show the changelog of the download", schema: stringSchema},
+}
+
+var imageParameters = []openApiParameter{
+	{name: "dark", description: "Renders a dark image when present", schema: stringSchema},
+	{name: "transparent", description: "Renders without a background when present", schema: stringSchema},
+	{name: "noThumbnail", description: "Leaves out the project thumbnail when present", schema: stringSchema},
+	{name: "quality", description: "Quality of JPEG and WebP images, from 1 to 100", schema: integerSchema},
+	{name: "lang", description: "Language of the image, defaults to the browser's", schema: stringSchema},
+}
+
+func openApiOperations() []openApiOperation {
+	project := []openApiParameter{{name: "{id}", description: "Project id", schema: integerSchema}}
+	projectPath := []openApiParameter{
+		{name: "{game}", description: "Game slug", schema: stringSchema},
+		{name: "{class}", description: "Class slug", schema: stringSchema},
+		{name: "{slug}", description: "Project slug", schema: stringSchema},
+	}
+	author := []openApiParameter{{name: "{id}", description: "Member id", schema: integerSchema}}
+
+	operations := []openApiOperation{
+		{method: "get", path: "/{id}", summary: "Get a project by id", parameters: join(project, projectParameters, fieldParameters), response: widget.ProjectProperties{}},
+		{method: "get", path: "/{game}/{class}/{slug}", summary: "Get a project by its CurseForge path", parameters: join(projectPath, projectParameters, fieldParameters), response: widget.ProjectProperties{}},
+		{method: "get", path: "/{id}/files/{fileId}/changelog", summary: "Get the changelog of a file", parameters: join(project, []openApiParameter{
+			{name: "{fileId}", description: "File id", schema: integerSchema},
+			{name: "format", description: "html or markdown to get just that", schema: stringSchema},
+		}), response: ChangelogResponse{}},
+		{method: "get", path: "/{id}/files", summary: "List the files of a project", parameters: join(project, []openApiParameter{
+			{name: "type", description: "Comma separated release types", schema: stringSchema},
+			{name: "version", description: "Game version or version range", schema: stringSchema},
+			{name: "loader", description: "Loader", schema: stringSchema},
+			{name: "from", description: "Only files uploaded after this date or time", schema: stringSchema},
+			{name: "to", description: "Only files uploaded before this date or time", schema: stringSchema},
+			{name: "sort", description: "uploaded or downloads", schema: stringSchema},
+			{name: "order", description: "asc or desc", schema: stringSchema},
+			{name: "page", description: "Page, starting at 1", schema: integerSchema},
+			{name: "per_page", description: "Files per page, up to 100", schema: integerSchema},
+		}), response: FilesResponse{}},
+		{method: "get", path: "/{id}/dependencies", summary: "Get the dependency tree of the download", parameters: join(project, projectParameters), response: DependencyNode{}},
+		{method: "get", path: "/author/{id}", summary: "Get an author by id", parameters: author, response: widget.AuthorResponse{}},
+		{method: "get", path: "/author/search/{username}", summary: "Get an author by username", parameters: []openApiParameter{{name: "{username}", description: "Username", schema: stringSchema}}, response: widget.AuthorResponse{}},
+		{method: "get", path: "/collection", summary: "Get many projects at once", parameters: join([]openApiParameter{{name: "ids", description: "Comma separated ids or paths", schema: stringSchema}}, projectParameters, fieldParameters), response: []widget.ProjectProperties{}},
+		{method: "get", path: "/search", summary: "Search projects", parameters: []openApiParameter{
+			{name: "q", description: "Text to search for", schema: stringSchema},
+			{name: "game", description: "Game slug, defaults to minecraft", schema: stringSchema},
+			{name: "class", description: "Class or category slug", schema: stringSchema},
+			{name: "version", description: "Game version", schema: stringSchema},
+			{name: "loader", description: "Loader", schema: stringSchema},
+			{name: "sort", description: "featured, popularity, updated, name, author, downloads, category or version", schema: stringSchema},
+			{name: "order", description: "asc or desc", schema: stringSchema},
+			{name: "page", description: "Page, starting at 1", schema: integerSchema},
+			{name: "per_page", description: "Results per page, up to 50", schema: integerSchema},
+		}, response: SearchResponse{}},
+		{method: "get", path: "/games", summary: "List the games", response: []GameResponse{}},
+		{method: "get", path: "/games/{slug}/categories", summary: "List the categories of a game as a tree", parameters: []openApiParameter{{name: "{slug}", description: "Game slug", schema: stringSchema}}, response: []CategoryResponse{}},
+		{method: "post", path: "/batch", summary: "Get many projects at once by id or path", request: BatchRequest{}, response: BatchResponse{}},
+		{method: "post", path: "/manifest", summary: "Resolve the files of a modpack manifest", parameters: []openApiParameter{{name: "format", description: "json, html or markdown", schema: stringSchema}}, request: Manifest{}, response: ManifestResponse{}},
+		{method: "get", path: "/v2/projects/{id}", summary: "Get a project by id", parameters: join(project, projectParameters, fieldParameters), response: V2Response{Data: V2Project{}}, errorResponse: V2ErrorResponse{}},
+		{method: "get", path: "/v2/authors/{id}", summary: "Get an author by id", parameters: author, response: V2Response{Data: V2Author{}}, errorResponse: V2ErrorResponse{}},
+
+		{method: "get", path: "/{id}", summary: "Render the widget for a project", web: true, parameters: join(project, projectParameters, widgetParameters), contentType: "text/html"},
+		{method: "get", path: "/{game}/{class}/{slug}", summary: "Render the widget for a project by its CurseForge path", web: true, parameters: join(projectPath, projectParameters, widgetParameters), contentType: "text/html"},
+		{method: "get", path: "/author/{id}", summary: "Render the widget for an author", web: true, parameters: join(author, widgetParameters), contentType: "text/html"},
+		{method: "get", path: "/collection", summary: "Render the widget for many projects", web: true, parameters: join([]openApiParameter{{name: "ids", description: "Comma separated ids or paths", schema: stringSchema}}, projectParameters, widgetParameters), contentType: "text/html"},
+	}
+
+	operations = append(operations, imageOperations("/{id}", "Render a project as an image", join(project, projectParameters, imageParameters))...)
+	operations = append(operations, imageOperations("/{game}/{class}/{slug}", "Render a project as an image by its CurseForge path", join(projectPath, projectParameters, imageParameters))...)
+	operations = append(operations, imageOperations("/author/{id}", "Render an author as an image", join(author, imageParameters))...)
+	operations = append(operations, imageOperations("/collection", "Render many projects as one image", join([]openApiParameter{
+		{name: "ids", description: "Comma separated ids or paths", schema: stringSchema},
+		{name: "columns", description: "How many projects to put on each row", schema: integerSchema},
+	}, projectParameters, imageParameters))...)
+
+	return operations
+}
+
+// imageOperations describes the path with each image extension, along with .img which picks the format from the
+// Accept header
+func imageOperations(path, summary string, parameters []openApiParameter) []openApiOperation {
+	extensions := make([]string, 0, len(imageExtensions))
+	for ext := range imageExtensions {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+
+	operations := make([]openApiOperation, 0, len(extensions)+1)
+	for _, ext := range extensions {
+		operations = append(operations, openApiOperation{
+			method:      "get",
+			path:        path + ext,
+			summary:     summary,
+			web:         true,
+			parameters:  parameters,
+			contentType: imageContentTypes[imageExtensions[ext]],
+		})
+	}
+	operations = append(operations, openApiOperation{
+		method:      "get",
+		path:        path + NegotiatedImageExtension,
+		summary:     summary + ", in the smallest format the Accept header allows",
+		web:         true,
+		parameters:  parameters,
+		contentType: "image/*",
+	})
+	return operations
+}
+
+func GetOpenApi(c *gin.Context) {
+	openApiOnce.Do(func() {
+		openApiSpec = buildOpenApiSpec(openApiOperations())
+	})
+
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", openApiSpec)
+	cacheHeaders(c, cacheExpireTime)
+	c.JSON(http.StatusOK, openApiSpec)
+	c.Abort()
+}
+
+func buildOpenApiSpec(operations []openApiOperation) openApiObject {
+	schemas := openApiObject{}
+	paths := openApiObject{}
+
+	apiServers := []openApiObject{{"url": "https://" + env.Get("API_HOSTNAME")}}
+	webServers := []openApiObject{{"url": "https://" + env.Get("WEB_HOSTNAME")}}
+
+	for _, op := range operations {
+		path := op.path
+		item, exists := paths[path].(openApiObject)
+		if !exists {
+			item = openApiObject{}
+			if op.web {
+				item["servers"] = webServers
+			}
+			paths[path] = item
+		}
+
+		parameters := make([]openApiObject, 0, len(op.parameters))
+		for _, p := range op.parameters {
+			in := "query"
+			name := p.name
+			if strings.HasPrefix(name, "{") {
+				in = "path"
+				name = strings.Trim(name, "{}")
+			}
+			parameter := openApiObject{"name": name, "in": in, "description": p.description, "required": in == "path", "schema": p.schema}
+			parameters = append(parameters, parameter)
+		}
+
+		content := openApiObject{}
+		if op.response != nil {
+			content["application/json"] = openApiObject{"schema": schemaFor(reflect.ValueOf(op.response), schemas)}
+		} else if op.contentType != "" {
+			content[op.contentType] = openApiObject{"schema": openApiObject{"type": "string", "format": "binary"}}
+		}
+
+		responses := openApiObject{
+			"200": openApiObject{"description": "OK", "content": content},
+			"404": openApiObject{"description": "Not found"},
+		}
+		if op.errorResponse != nil {
+			errorContent := openApiObject{
+				"application/json": openApiObject{"schema": schemaFor(reflect.ValueOf(op.errorResponse), schemas)},
+			}
+			responses["404"] = openApiObject{"description": "Not found", "content": errorContent}
+			responses["default"] = openApiObject{"description": "Error", "content": errorContent}
+		}
+
+		operation := openApiObject{
+			"summary":    op.summary,
+			"parameters": parameters,
+			"responses":  responses,
+		}
+
+		if op.request != nil {
+			operation["requestBody"] = openApiObject{
+				"required": true,
+				"content": openApiObject{
+					"application/json": openApiObject{"schema": schemaFor(reflect.ValueOf(op.request), schemas)},
+				},
+			}
+		}
+
+		if _, exists := item[op.method]; exists {
+			//the widget shares its path with the project, so describe both hosts on the one operation
+			existing := item[op.method].(openApiObject)
+			existing["description"] = "The API host responds with JSON, the widget host with the HTML widget."
+			existing["parameters"] = mergeParameters(existing["parameters"].([]openApiObject), parameters)
+			existing["responses"].(openApiObject)["200"].(openApiObject)["content"].(openApiObject)[op.contentType] = openApiObject{"schema": stringSchema}
+			item["servers"] = append(apiServers, webServers...)
+			continue
+		}
+
+		item[op.method] = operation
+	}
+
+	return openApiObject{
+		"openapi": "3.0.3",
+		"info": openApiObject{
+			"title":   "CFWidget",
+			"version": "1",
+		},
+		"servers":    apiServers,
+		"paths":      paths,
+		"components": openApiObject{"schemas": schemas},
+	}
+}
+
+func mergeParameters(existing, extra []openApiObject) []openApiObject {
+	seen := make(map[string]bool)
+	for _, v := range existing {
+		seen[v["in"].(string)+":"+v["name"].(string)] = true
+	}
+	for _, v := range extra {
+		if !seen[v["in"].(string)+":"+v["name"].(string)] {
+			existing = append(existing, v)
+		}
+	}
+	return existing
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor builds the schema from the value, values are used rather than types so interface{} fields can be filled in
+func schemaFor(value reflect.Value, schemas openApiObject) openApiObject {
+	t := value.Type()
+
+	if t.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return openApiObject{}
+		}
+		value = value.Elem()
+		t = value.Type()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		var elem reflect.Value
+		if value.IsNil() {
+			elem = reflect.Zero(t.Elem())
+		} else {
+			elem = value.Elem()
+		}
+		schema := schemaFor(elem, schemas)
+		if _, isRef := schema["$ref"]; isRef {
+			return openApiObject{"allOf": []openApiObject{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return openApiObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openApiObject{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openApiObject{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return openApiObject{"type": "number"}
+	case reflect.String:
+		return openApiObject{"type": "string"}
+	case reflect.Slice:
+		//nil slices are written as null, which older stored projects have for fields added since
+		return openApiObject{"type": "array", "items": schemaFor(reflect.Zero(t.Elem()), schemas), "nullable": true}
+	case reflect.Array:
+		return openApiObject{"type": "array", "items": schemaFor(reflect.Zero(t.Elem()), schemas)}
+	case reflect.Map:
+		return openApiObject{"type": "object", "additionalProperties": schemaFor(reflect.Zero(t.Elem()), schemas), "nullable": true}
+	case reflect.Struct:
+		if t == timeType {
+			return openApiObject{"type": "string", "format": "date-time"}
+		}
+	default:
+		return openApiObject{}
+	}
+
+	//named types are shared as components, unless something has been filled in, such as the data of a V2Response
+	name := schemaName(t)
+	if name != "" {
+		if _, exists := schemas[name]; exists {
+			return openApiObject{"$ref": "#/components/schemas/" + name}
+		}
+		//hold the place so types which contain themselves, like the category tree, refer back to it
+		schemas[name] = openApiObject{}
+	}
+
+	//fields are only required when tagged openapi:"required", as anything can be left out with fields and exclude.
+	//Fields tagged openapi:"anyOf" need at least one of them given.
+	properties := openApiObject{}
+	required := make([]string, 0)
+	anyOf := make([]openApiObject, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+		}
+
+		properties[name] = schemaFor(value.Field(i), schemas)
+		switch field.Tag.Get("openapi") {
+		case "required":
+			required = append(required, name)
+		case "anyOf":
+			given := openApiObject{"required": []string{name}}
+			if field.Type.Kind() == reflect.Slice {
+				//an empty list is no better than leaving it out
+				given["properties"] = openApiObject{name: openApiObject{"minItems": 1}}
+			}
+			anyOf = append(anyOf, given)
+		}
+	}
+
+	schema := openApiObject{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	if len(anyOf) > 0 {
+		schema["anyOf"] = anyOf
+	}
+
+	if name == "" {
+		return schema
+	}
+	schemas[name] = schema
+	return openApiObject{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaName is the component name of the type, types from other packages are prefixed with the package name
+func schemaName(t reflect.Type) string {
+	if t.Name() == "" {
+		return ""
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() == reflect.Interface {
+			return ""
+		}
+	}
+
+	if t.PkgPath() == reflect.TypeOf(openApiOperation{}).PkgPath() {
+		return t.Name()
+	}
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
+
+func join(lists ...[]openApiParameter) []openApiParameter {
+	result := make([]openApiParameter, 0)
+	for _, v := range lists {
+		result = append(result, v...)
+	}
+	return result
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testApiHost = "api.cfwidget.test"
+	testWebHost = "cfwidget.test"
+)
+
+// oldProjectProperties is a project stored before files had loaders and game versions, and before screenshots were kept
+const oldProjectProperties = `{
+	"id": 1001,
+	"title": "Old Library",
+	"summary": "Stored a long time ago",
+	"game": "minecraft",
+	"type": "Mods",
+	"urls": {"curseforge": "https://www.curseforge.com/minecraft/mc-mods/old-library"},
+	"created_at": "2018-01-01T00:00:00Z",
+	"downloads": {"total": 10},
+	"categories": ["Library"],
+	"members": [{"title": "Owner", "username": "someone", "id": 50}],
+	"links": [],
+	"files": [{"id": 3000, "url": "https://www.curseforge.com/minecraft/mc-mods/old-library/files/3000", "display": "old-library-1.0.jar", "name": "old-library-1.0.jar", "type": "release", "version": "1.12.2", "filesize": 100, "versions": ["1.12.2", "Forge"], "downloads": 10, "uploaded_at": "2018-01-01T00:00:00Z"}],
+	"versions": {"1.12.2": [{"id": 3000, "url": "", "display": "old-library-1.0.jar", "name": "old-library-1.0.jar", "type": "release", "version": "1.12.2", "filesize": 100, "versions": ["1.12.2", "Forge"], "downloads": 10, "uploaded_at": "2018-01-01T00:00:00Z"}]},
+	"download": {"id": 3000, "url": "", "display": "old-library-1.0.jar", "name": "old-library-1.0.jar", "type": "release", "version": "1.12.2", "filesize": 100, "versions": ["1.12.2", "Forge"], "downloads": 10, "uploaded_at": "2018-01-01T00:00:00Z"}
+}`
+
+type openApiTestCase struct {
+	method string
+	url    string
+	body   string
+	//path is the path in the spec the response is checked against
+	path string
+	//status is what the response should be, when it isn't 200
+	status int
+}
+
+// TestOpenApiMatchesResponses runs requests through the handlers and checks the responses against the spec we serve
+func TestOpenApiMatchesResponses(t *testing.T) {
+	t.Setenv("API_HOSTNAME", testApiHost)
+	t.Setenv("WEB_HOSTNAME", testWebHost)
+	setupTestDatabase(t)
+
+	//file changelogs are kept once fetched, so put one in place rather than going to CurseForge
+	cached := changelogs
+	changelogs = newChangelogCache(1 << 20)
+	changelogs.set(cachedChangelog{fileId: 2000, html: "<p>Fixed things</p>", markdown: "Fixed things", expireAt: time.Now().Add(time.Hour)})
+	t.Cleanup(func() {
+		changelogs = cached
+	})
+
+	doc := loadOpenApiSpec(t)
+
+	engine := gin.New()
+	RegisterApiRoutes(engine)
+
+	tests := []openApiTestCase{
+		{method: "GET", url: "/1000", path: "/{id}"},
+		{method: "GET", url: "/1000.json?fields=title,files", path: "/{id}"},
+		{method: "GET", url: "/1000?exclude=id,files,versions", path: "/{id}"},
+		{method: "GET", url: "/1001", path: "/{id}"},
+		{method: "GET", url: "/minecraft/mc-mods/new-mod", path: "/{game}/{class}/{slug}"},
+		{method: "GET", url: "/1000/files", path: "/{id}/files"},
+		{method: "GET", url: "/1000/files?version=>=1.20&loader=fabric&sort=downloads", path: "/{id}/files"},
+		{method: "GET", url: "/1001/files", path: "/{id}/files"},
+		{method: "GET", url: "/1000/files/2000/changelog", path: "/{id}/files/{fileId}/changelog"},
+		{method: "GET", url: "/1000/dependencies", path: "/{id}/dependencies"},
+		{method: "GET", url: "/author/50", path: "/author/{id}"},
+		{method: "GET", url: "/author/search/someone", path: "/author/search/{username}"},
+		{method: "GET", url: "/collection?ids=1000,1001", path: "/collection"},
+		{method: "GET", url: "/collection?ids=1000&fields=title", path: "/collection"},
+		{method: "GET", url: "/games", path: "/games"},
+		{method: "GET", url: "/v2/projects/1000", path: "/v2/projects/{id}"},
+		{method: "GET", url: "/v2/projects/1001", path: "/v2/projects/{id}"},
+		{method: "GET", url: "/v2/projects/1000?fields=title", path: "/v2/projects/{id}"},
+		{method: "GET", url: "/v2/authors/50", path: "/v2/authors/{id}"},
+		{method: "GET", url: "/v2/projects/1002", path: "/v2/projects/{id}", status: http.StatusNotFound},
+		{method: "POST", url: "/batch", body: `{"ids": [1000, 1001]}`, path: "/batch"},
+		{method: "POST", url: "/batch", body: `{"paths": ["minecraft/mc-mods/new-mod"]}`, path: "/batch"},
+		{method: "POST", url: "/manifest", body: `{"name": "Pack", "version": "1.0", "author": "someone", "minecraft": {"version": "1.20.1", "modLoaders": [{"id": "fabric-0.14.21"}]}, "files": [{"projectID": 1000, "fileID": 2000, "required": true}, {"projectID": 1001, "fileID": 3000, "required": false}]}`, path: "/manifest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.url, func(t *testing.T) {
+			operation := doc.Paths.Find(test.path).GetOperation(test.method)
+			if operation == nil {
+				t.Fatalf("spec has no %s %s", test.method, test.path)
+			}
+
+			if test.body != "" {
+				validateOpenApiBody(t, "request", operation.RequestBody.Value.Content.Get("application/json").Schema.Value, []byte(test.body))
+			}
+
+			request := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			request.Host = testApiHost
+			if test.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			status := test.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if recorder.Code != status {
+				t.Fatalf("expected %d, got %d: %s", status, recorder.Code, recorder.Body.String())
+			}
+
+			schema := operation.Responses.Get(status).Value.Content.Get("application/json").Schema.Value
+			validateOpenApiBody(t, "response", schema, recorder.Body.Bytes())
+		})
+	}
+}
+
+// TestOpenApiDescribesWebRoutes checks the widget host responds with what the spec says it does
+func TestOpenApiDescribesWebRoutes(t *testing.T) {
+	t.Setenv("API_HOSTNAME", testApiHost)
+	t.Setenv("WEB_HOSTNAME", testWebHost)
+	setupTestDatabase(t)
+
+	doc := loadOpenApiSpec(t)
+
+	engine := gin.New()
+	RegisterApiRoutes(engine)
+
+	tests := []openApiTestCase{
+		{method: "GET", url: "/1000", path: "/{id}"},
+		{method: "GET", url: "/minecraft/mc-mods/new-mod", path: "/{game}/{class}/{slug}"},
+		{method: "GET", url: "/author/50", path: "/author/{id}"},
+		{method: "GET", url: "/collection?ids=1000,1001", path: "/collection"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			operation := doc.Paths.Find(test.path).GetOperation(test.method)
+			if operation == nil {
+				t.Fatalf("spec has no %s %s", test.method, test.path)
+			}
+
+			request := httptest.NewRequest(test.method, test.url, nil)
+			request.Host = testWebHost
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+			}
+			contentType := recorder.Header().Get("Content-Type")
+			if operation.Responses.Get(http.StatusOK).Value.Content.Get(contentType) == nil {
+				t.Errorf("spec does not describe %s responses", contentType)
+			}
+		})
+	}
+
+	//the images aren't rendered here, as that needs the thumbnails from CurseForge
+	for _, path := range []string{"/{id}.png", "/{id}.jpg", "/{id}.webp", "/{id}.img", "/{game}/{class}/{slug}.png", "/{game}/{class}/{slug}.img", "/author/{id}.jpeg", "/author/{id}.img", "/collection.webp", "/collection.img"} {
+		if doc.Paths.Find(path) == nil {
+			t.Errorf("spec has no %s", path)
+		}
+	}
+}
+
+// TestOpenApiBatchRequestNeedsIdsOrPaths checks the spec only accepts the batch requests BatchCall accepts
+func TestOpenApiBatchRequestNeedsIdsOrPaths(t *testing.T) {
+	doc := loadOpenApiSpec(t)
+	schema := doc.Paths.Find("/batch").Post.RequestBody.Value.Content.Get("application/json").Schema.Value
+
+	for _, body := range []string{`{"ids": [1]}`, `{"paths": ["minecraft/mc-mods/jei"]}`, `{"ids": [1], "paths": ["minecraft/mc-mods/jei"]}`} {
+		validateOpenApiBody(t, "request", schema, []byte(body))
+	}
+
+	for _, body := range []string{`{}`, `{"ids": []}`, `{"ids": [], "paths": []}`} {
+		var value interface{}
+		_ = json.Unmarshal([]byte(body), &value)
+		if err := schema.VisitJSON(value); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
+
+func loadOpenApiSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	data, err := json.Marshal(buildOpenApiSpec(openApiOperations()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = doc.Validate(loader.Context); err != nil {
+		t.Fatalf("spec is not valid: %s", err)
+	}
+	return doc
+}
+
+func validateOpenApiBody(t *testing.T, kind string, schema *openapi3.Schema, body []byte) {
+	t.Helper()
+
+	var value interface{}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&value); err != nil {
+		t.Fatalf("%s is not JSON: %s", kind, err)
+	}
+	if err := schema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		t.Errorf("%s does not match the spec: %s\n%s", kind, err, body)
+	}
+}
+
+// setupTestDatabase swaps in an in-memory database with a current project, an old one, a missing one and their author.
+// The tables are made by hand, as the MySQL collations on the models aren't understood by SQLite.
+func setupTestDatabase(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//every connection would get its own empty database
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, statement := range []string{
+		"CREATE TABLE projects (id INTEGER PRIMARY KEY, properties TEXT, status INTEGER, created_at DATETIME, updated_at DATETIME, error TEXT)",
+		"CREATE TABLE authors (member_id INTEGER PRIMARY KEY, username TEXT, properties TEXT, created_at DATETIME, updated_at DATETIME)",
+		"CREATE TABLE project_lookups (path TEXT PRIMARY KEY, curse_id INTEGER, created_at DATETIME, updated_at DATETIME)",
+	} {
+		if err = db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, err := json.Marshal(testProjectProperties())
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentProperties, oldProperties := string(current), oldProjectProperties
+	authorProperties := `{"projects": [{"id": 1000, "name": "New Mod"}, {"id": 1001, "name": "Old Library"}]}`
+	curseId := uint(1000)
+	//CurseForge told us this one doesn't exist, so it isn't looked up again
+	missingProperties := `{"id": 1002}`
+
+	for _, v := range []interface{}{
+		&widget.Project{CurseId: 1000, Properties: &currentProperties, Status: http.StatusOK},
+		&widget.Project{CurseId: 1001, Properties: &oldProperties, Status: http.StatusOK},
+		&widget.Project{CurseId: 1002, Properties: &missingProperties, Status: http.StatusNotFound},
+		&widget.Author{MemberId: 50, Username: "someone", Properties: &authorProperties},
+		&widget.ProjectLookup{Path: "minecraft/mc-mods/new-mod", CurseId: &curseId},
+	} {
+		if err = db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_db = db
+	t.Cleanup(func() {
+		_db = nil
+	})
+}
+
+func testProjectProperties() widget.ProjectProperties {
+	allowed := true
+	uploaded := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	file := widget.ProjectFile{
+		Id:           2000,
+		Url:          "https://www.curseforge.com/minecraft/mc-mods/new-mod/files/2000",
+		Display:      "New Mod 2.0",
+		Name:         "new-mod-2.0.jar",
+		Type:         "release",
+		Version:      "1.20.1",
+		FileSize:     2048,
+		Versions:     []string{"1.20.1", "Fabric"},
+		Downloads:    500,
+		UploadedAt:   uploaded,
+		DownloadUrl:  "https://edge.forgecdn.net/files/2000/new-mod-2.0.jar",
+		Dependencies: []widget.FileDependency{{Id: 1001, Type: "required", Title: "Old Library"}},
+		Loaders:      []string{"fabric"},
+		GameVersions: []string{"1.20.1"},
+	}
+
+	return widget.ProjectProperties{
+		Id:          1000,
+		Title:       "New Mod",
+		Summary:     "Recently synced",
+		Description: "<p>New</p>",
+		Game:        "minecraft",
+		Type:        "Mods",
+		Urls:        map[string]string{"curseforge": "https://www.curseforge.com/minecraft/mc-mods/new-mod"},
+		Thumbnail:   "https://media.forgecdn.net/avatars/1/1.png",
+		CreatedAt:   uploaded,
+		Downloads:   map[string]uint64{"total": 500},
+		Categories:  []string{"Utility"},
+		Members:     []widget.ProjectMember{{Title: "Owner", Username: "someone", Id: 50}},
+		Links:       []string{},
+		Files:       []widget.ProjectFile{file},
+		Versions:    widget.VersionIndex{"1.20.1": {file}},
+		Loaders:     map[string][]widget.ProjectFile{"fabric": {file}},
+		Download:    &file,
+		Screenshots: []widget.ProjectScreenshot{{Title: "Menu", Url: "https://media.forgecdn.net/attachments/1/1.png"}},
+		UpdatedAt:   uploaded,
+		ReleasedAt:  uploaded,
+
+		AllowModDistribution: &allowed,
+		IsFeatured:           false,
+		Rating:               4.5,
+		ClassId:              6,
+		MainFileId:           2000,
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimitIdle is how long a client's limiter is kept after their last request
+const rateLimitIdle = 10 * time.Minute
+
+type rateLimitContextKey struct{}
+
+// RateLimitError is given when a request would need to call CurseForge, but the client has used up their budget
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+// rateLimiter keeps a token bucket for each client, creating them as they're first seen
+type rateLimiter struct {
+	lock     sync.Mutex
+	limiters map[string]*clientLimiter
+	limit    rate.Limit
+	burst    int
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+var requestLimiter = newRateLimiter(env.GetIntOr("RATE_LIMIT_PER_MINUTE", 120), env.GetIntOr("RATE_LIMIT_BURST", 30))
+
+// upstreamLimiter is the stricter budget for requests which make us call CurseForge
+var upstreamLimiter = newRateLimiter(env.GetIntOr("UPSTREAM_RATE_LIMIT_PER_MINUTE", 10), env.GetIntOr("UPSTREAM_RATE_LIMIT_BURST", 5))
+
+func init() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for range ticker.C {
+			requestLimiter.clean()
+			upstreamLimiter.clean()
+		}
+	}()
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		limiters: make(map[string]*clientLimiter),
+		limit:    rate.Limit(float64(perMinute) / 60),
+		burst:    burst,
+	}
+}
+
+// reserve takes a token for the client, returning how long they need to wait when there isn't one.
+// A limit of 0 or less turns the limiter off, and perMinute overrides the default limit for the client.
+func (l *rateLimiter) reserve(key string, perMinute int) time.Duration {
+	limit := l.limit
+	if perMinute > 0 {
+		limit = rate.Limit(float64(perMinute) / 60)
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	l.lock.Lock()
+	client, exists := l.limiters[key]
+	if !exists {
+		client = &clientLimiter{limiter: rate.NewLimiter(limit, l.burst)}
+		l.limiters[key] = client
+	}
+	client.lastSeen = time.Now()
+	if client.limiter.Limit() != limit {
+		client.limiter.SetLimit(limit)
+	}
+	l.lock.Unlock()
+
+	reservation := client.limiter.Reserve()
+	if !reservation.OK() {
+		return time.Minute
+	}
+	delay := reservation.Delay()
+	if delay > 0 {
+		//they aren't going to wait for it, so give the token back
+		reservation.Cancel()
+	}
+	return delay
+}
+
+func (l *rateLimiter) clean() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for k, v := range l.limiters {
+		if time.Since(v.lastSeen) > rateLimitIdle {
+			delete(l.limiters, k)
+		}
+	}
+}
+
+// rateLimit limits API clients by the API key authenticate found when they have one and otherwise their IP, which gin
+// takes from the proxy headers when the request came through a trusted proxy. Requests to the widget host aren't
+// limited, as embedded widgets and images are often fetched through shared proxies which would use up one IP's budget
+// for everyone behind them, but they still have the CurseForge budget of their IP.
+func rateLimit(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), rateLimitContextKey{}, "ip:"+c.ClientIP()))
+		return
+	}
+
+	key, perMinute := "ip:"+c.ClientIP(), 0
+	if obj, exists := c.Get("apiKey"); exists {
+		apiKey := obj.(*widget.ApiKey)
+		key, perMinute = fmt.Sprintf("key:%d", apiKey.Id), apiKey.RequestsPerMinute
+	}
+
+	if delay := requestLimiter.reserve(key, perMinute); delay > 0 {
+		abortRateLimited(c, delay)
+		return
+	}
+
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), rateLimitContextKey{}, key))
+}
+
+// allowUpstream takes from the client's CurseForge budget, anything not from a client request is always allowed
+func allowUpstream(ctx context.Context) error {
+	key, ok := ctx.Value(rateLimitContextKey{}).(string)
+	if !ok {
+		return nil
+	}
+
+	if delay := upstreamLimiter.reserve(key, 0); delay > 0 {
+		return RateLimitError{RetryAfter: delay}
+	}
+	return nil
+}
+
+func setRetryAfter(c *gin.Context, delay time.Duration) {
+	c.Header("Retry-After", fmt.Sprint(int(math.Ceil(delay.Seconds()))))
+}
+
+func abortRateLimited(c *gin.Context, delay time.Duration) {
+	setRetryAfter(c, delay)
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, ApiWebResponse{Error: "too many requests"})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"net/http"
+	"strings"
+)
+
+// projectResources are the things which can be asked for under a project, such as /{id}/files/{fileId}/changelog
+var projectResources = []string{"files", "dependencies"}
+
+// splitProjectResource splits a path into the project and what's being asked for under it.
+// Only ids and game/class/slug paths can have a resource, so other paths are left for the lookup to handle.
+func splitProjectResource(path string) (string, string) {
+	parts := strings.Split(path, "/")
+
+	projectLength := 3
+	if _, err := cast.ToUintE(parts[0]); err == nil {
+		projectLength = 1
+	}
+
+	if len(parts) <= projectLength || !contains(parts[projectLength], projectResources) {
+		return path, ""
+	}
+
+	return strings.Join(parts[:projectLength], "/"), strings.Join(parts[projectLength:], "/")
+}
+
+func handleProjectResource(c *gin.Context, path, resource string) {
+	handleResolveProject(c, path)
+	if c.IsAborted() {
+		return
+	}
+
+	project := c.MustGet("project").(*widget.Project)
+	if project.ParsedProjects == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	parts := strings.Split(resource, "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "files" && parts[2] == "changelog":
+		fileId, err := cast.ToUintE(parts[1])
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		getChangelog(c, project.ParsedProjects, fileId)
+	case resource == "files":
+		getFiles(c, project.ParsedProjects)
+	case resource == "dependencies":
+		getDependencies(c, project.ParsedProjects)
+	default:
+		SetInCache(c.Request.Host, cacheKey(c), http.StatusNotFound, "", nil)
+		c.AbortWithStatus(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"github.com/cfwidget/cfwidget/curseforge"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"net/http"
+	"strings"
+)
+
+const SearchPath = "search"
+
+const (
+	DefaultSearchPageSize = 20
+	// MaxSearchResults is as deep as CurseForge will let a search page go
+	MaxSearchResults = 10000
+)
+
+type SearchResponse struct {
+	Data       []*widget.ProjectProperties `json:"data" openapi:"required"`
+	Pagination Pagination                  `json:"pagination" openapi:"required"`
+}
+
+type Pagination struct {
+	Page    int `json:"page" openapi:"required"`
+	PerPage int `json:"per_page" openapi:"required"`
+	Total   int `json:"total" openapi:"required"`
+}
+
+func GetSearch(c *gin.Context) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	page := cast.ToInt(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := cast.ToInt(c.DefaultQuery("per_page", cast.ToString(DefaultSearchPageSize)))
+	if perPage < 1 {
+		perPage = DefaultSearchPageSize
+	}
+	//asking for more than CurseForge gives in one page gets as many as it does give
+	if perPage > curseforge.PageSize {
+		perPage = curseforge.PageSize
+	}
+	if page*perPage > MaxSearchResults {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "page is too deep"})
+		return
+	}
+
+	request := curseforge.SearchRequest{
+		SearchFilter: c.Query("q"),
+		GameVersion:  c.Query("version"),
+		Index:        (page - 1) * perPage,
+		PageSize:     perPage,
+	}
+
+	game := curseforge.GetGameBySlug(c.DefaultQuery("game", "minecraft"))
+	if game.Id == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "unknown game"})
+		return
+	}
+	request.GameId = game.Id
+
+	if class := c.Query("class"); class != "" {
+		categories, err := curseforge.GetCategories(game.Id, ctx)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+			return
+		}
+
+		category, err := findSearchCategory(categories, class)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: err.Error()})
+			return
+		}
+
+		if category.IsClass {
+			request.ClassId = category.Id
+		} else {
+			request.ClassId = category.ClassId
+			request.CategoryId = category.Id
+		}
+	}
+
+	if loader := c.Query("loader"); loader != "" {
+		request.ModLoaderType = curseforge.GetModLoaderType(loader)
+		if request.ModLoaderType == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "unknown loader"})
+			return
+		}
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		request.SortField = curseforge.GetSearchSortField(sort)
+		if request.SortField == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ApiWebResponse{Error: "unknown sort"})
+			return
+		}
+
+		request.SortOrder = "desc"
+		if strings.ToLower(c.Query("order")) == "asc" {
+			request.SortOrder = "asc"
+		}
+	}
+
+	var rateLimitErr RateLimitError
+	if errors.As(allowUpstream(ctx), &rateLimitErr) {
+		abortRateLimited(c, rateLimitErr.RetryAfter)
+		return
+	}
+
+	result, err := curseforge.Search(request, ctx)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	response := SearchResponse{
+		Data: make([]*widget.ProjectProperties, 0, len(result.Data)),
+		Pagination: Pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   result.Pagination.TotalCount,
+		},
+	}
+
+	for _, v := range result.Data {
+		response.Data = append(response.Data, newProjectProperties(v, ctx))
+	}
+
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", response)
+	cacheHeaders(c, cacheExpireTime)
+	c.JSON(http.StatusOK, response)
+	c.Abort()
+}
+
+// findSearchCategory finds the class or category with the slug, classes win as they are what paths use
+func findSearchCategory(categories []curseforge.Category, slug string) (curseforge.Category, error) {
+	var match curseforge.Category
+	for _, v := range categories {
+		if v.Slug != slug {
+			continue
+		}
+		if v.IsClass {
+			return v, nil
+		}
+		if match.Id == 0 {
+			match = v
+		}
+	}
+
+	if match.Id == 0 {
+		return match, errors.New("unknown class")
+	}
+	return match, nil
+}
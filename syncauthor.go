@@ -5,8 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/cfwidget/cfwidget/widget"
-	"go.elastic.co/apm/v2"
 	"gorm.io/gorm"
 	"log"
 	"time"
@@ -15,6 +16,12 @@ import (
 var syncAuthorConsumer SyncAuthorConsumer
 var syncAuthorChan = make(chan uint, 500)
 
+func init() {
+	metrics.RegisterQueueDepth("sync_author", func() int {
+		return len(syncAuthorChan)
+	})
+}
+
 func syncAuthorWorker() {
 	for i := range syncAuthorChan {
 		process(i)
@@ -22,17 +29,15 @@ func syncAuthorWorker() {
 }
 
 func process(id uint) {
-	trans := apm.DefaultTracer().StartTransaction("authorSync", "schedule")
+	trans, ctx := tracing.StartTransaction(context.Background(), "authorSync", "schedule")
 	defer trans.End()
 
 	defer func() {
 		err := recover()
 		if err != nil {
-			trans.Outcome = "failure"
+			trans.SetFailed()
 		}
 	}()
-
-	ctx := apm.ContextWithTransaction(context.Background(), trans)
 	syncAuthorConsumer.Consume(id, ctx)
 }
 
@@ -66,6 +71,9 @@ func (consumer *SyncAuthorConsumer) Consume(id uint, ctx context.Context) *widge
 		err := recover()
 		if err != nil {
 			fmt.Printf("Error syncing author: %s\n", err)
+			metrics.ObserveSync("author", fmt.Errorf("%v", err))
+		} else {
+			metrics.ObserveSync("author", nil)
 		}
 	}()
 
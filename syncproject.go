@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/cfwidget/cfwidget/curseforge"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
 	"github.com/cfwidget/cfwidget/widget"
 	"github.com/spf13/cast"
 	"gorm.io/gorm"
@@ -25,8 +26,6 @@ var remoteUrlRegex = regexp.MustCompile("\"/linkout\\?remoteUrl=(?P<Url>\\S*)\""
 var NoProjectError = errors.New("no such project")
 var PrivateProjectError = errors.New("project private")
 
-var invalidVersions = []string{"Forge", "Fabric", "Quilt", "Rift"}
-
 func SyncProject(id uint, ctx context.Context) (*widget.Project, error) {
 	//just directly perform the call, we want this one now
 	return syncProjectConsumer.Consume(id, ctx)
@@ -34,13 +33,27 @@ func SyncProject(id uint, ctx context.Context) (*widget.Project, error) {
 
 type SyncProjectConsumer struct{}
 
-func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context) (project *widget.Project, err error) {
+func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context) (*widget.Project, error) {
+	return consumer.consume(curseId, nil, ctx)
+}
+
+// ConsumeAddon syncs a project using properties which have already been fetched, such as from a bulk lookup
+func (consumer *SyncProjectConsumer) ConsumeAddon(addon curseforge.Addon, ctx context.Context) (*widget.Project, error) {
+	return consumer.consume(addon.Id, &addon, ctx)
+}
+
+func (consumer *SyncProjectConsumer) consume(curseId uint, addon *curseforge.Addon, ctx context.Context) (project *widget.Project, err error) {
 	db, err := GetDatabase()
 	if err != nil {
 		return nil, err
 	}
 	db = db.WithContext(ctx)
 
+	//registered first so it sees the error the recover below sets
+	defer func() {
+		metrics.ObserveSync("project", err)
+	}()
+
 	//let this handle how to mark the job
 	//if we get an error, it failed
 	//otherwise, it's fine
@@ -73,22 +86,26 @@ func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context)
 		panic(err)
 	}
 
-	addon, err := getAddonProperties(curseId, ctx)
-	if err != nil {
-		if errors.Is(err, NoProjectError) {
-			project.Status = 404
-		} else if errors.Is(err, PrivateProjectError) {
-			project.Status = 403
-		} else {
-			panic(err)
-		}
-
-		err = db.Save(project).Error
+	if addon == nil {
+		var fetched curseforge.Addon
+		fetched, err = getAddonProperties(curseId, ctx)
 		if err != nil {
-			panic(err)
-		}
+			if errors.Is(err, NoProjectError) {
+				project.Status = 404
+			} else if errors.Is(err, PrivateProjectError) {
+				project.Status = 403
+			} else {
+				panic(err)
+			}
 
-		return nil, err
+			err = db.Save(project).Error
+			if err != nil {
+				panic(err)
+			}
+
+			return nil, err
+		}
+		addon = &fetched
 	}
 
 	description, err := getAddonDescription(curseId, ctx)
@@ -96,47 +113,8 @@ func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context)
 		panic(err)
 	}
 
-	newProps := &widget.ProjectProperties{
-		Id:          addon.Id,
-		Title:       addon.Name,
-		Summary:     addon.Summary,
-		Description: description,
-		Game:        curseforge.GetGame(addon.GameId).Slug,
-		Type:        "",
-		Urls: map[string]string{
-			"curseforge": addon.Links.WebsiteUrl,
-			"project":    addon.Links.WebsiteUrl,
-		},
-		CreatedAt: addon.DateCreated,
-		Downloads: map[string]uint64{
-			"monthly": 0,
-			"total":   cast.ToUint64(addon.DownloadCount),
-		},
-		License:    "",
-		Donate:     "",
-		Categories: make([]string, 0),
-		Members:    make([]widget.ProjectMember, 0),
-		Links:      make([]string, 0),
-		Files:      make([]widget.ProjectFile, 0),
-		Versions:   map[string][]widget.ProjectFile{},
-	}
-
-	for _, v := range addon.Categories {
-		newProps.Categories = append(newProps.Categories, v.Name)
-	}
-
-	categories, err := curseforge.GetCategories(addon.GameId, ctx)
-	newProps.Type = curseforge.GetPrimaryCategoryFor(categories, addon.PrimaryCategoryId).Name
-
-	newProps.Thumbnail = addon.Logo.ThumbnailUrl
-
-	for _, v := range addon.Authors {
-		newProps.Members = append(newProps.Members, widget.ProjectMember{
-			Username: v.Name,
-			Title:    coalesce("Owner"),
-			Id:       v.Id,
-		})
-	}
+	newProps := newProjectProperties(*addon, ctx)
+	newProps.Description = description
 
 	//files!!!!
 	//we have to call their API to get this stuff
@@ -153,39 +131,41 @@ func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context)
 		}
 
 		file := widget.ProjectFile{
-			Id:         v.Id,
-			Url:        fmt.Sprintf("%s/files/%d", addon.Links.WebsiteUrl, v.Id),
-			Display:    v.DisplayName,
-			Name:       v.FileName,
-			Type:       curseforge.GetReleaseType(v.ReleaseType),
-			Version:    firstOrEmpty(v.GameVersions),
-			FileSize:   v.FileLength,
-			Versions:   v.GameVersions,
-			Downloads:  v.DownloadCount,
-			UploadedAt: v.FileDate,
+			Id:           v.Id,
+			Url:          fmt.Sprintf("%s/files/%d", addon.Links.WebsiteUrl, v.Id),
+			Display:      v.DisplayName,
+			Name:         v.FileName,
+			Type:         curseforge.GetReleaseType(v.ReleaseType),
+			Version:      firstOrEmpty(v.GameVersions),
+			FileSize:     v.FileLength,
+			Versions:     v.GameVersions,
+			Downloads:    v.DownloadCount,
+			UploadedAt:   v.FileDate,
+			DownloadUrl:  v.DownloadUrl,
+			Dependencies: make([]widget.FileDependency, 0, len(v.Dependencies)),
 		}
 
-		for _, g := range v.GameVersions {
-			if !contains(g, invalidVersions) {
-				file.Version = g
-				break
-			}
+		for _, dep := range v.Dependencies {
+			file.Dependencies = append(file.Dependencies, widget.FileDependency{
+				Id:   dep.ModId,
+				Type: curseforge.GetRelationType(dep.RelationType),
+			})
 		}
 
+		file.Loaders, file.GameVersions = v.SplitGameVersions()
+		file.Version = firstOr(file.GameVersions, file.Version)
+
 		newProps.Files = append(newProps.Files, file)
+	}
 
-		for _, ver := range file.Versions {
-			if contains(ver, invalidVersions) {
-				continue
-			}
-			d, e := newProps.Versions[ver]
-			if !e {
-				d = []widget.ProjectFile{file}
-			} else {
-				d = append(d, file)
-			}
+	setDependencyTitles(newProps.Files, db)
 
-			newProps.Versions[ver] = d
+	for _, file := range newProps.Files {
+		for _, ver := range file.GameVersions {
+			newProps.Versions[ver] = append(newProps.Versions[ver], file)
+		}
+		for _, loader := range file.Loaders {
+			newProps.Loaders[loader] = append(newProps.Loaders[loader], file)
 		}
 	}
 
@@ -246,6 +226,127 @@ func (consumer *SyncProjectConsumer) Consume(curseId uint, ctx context.Context)
 	return project, nil
 }
 
+// newProjectProperties fills in everything we know about a project from the addon alone, without files
+func newProjectProperties(addon curseforge.Addon, ctx context.Context) *widget.ProjectProperties {
+	newProps := &widget.ProjectProperties{
+		Id:      addon.Id,
+		Title:   addon.Name,
+		Summary: addon.Summary,
+		Game:    curseforge.GetGame(addon.GameId).Slug,
+		Type:    "",
+		Urls: map[string]string{
+			"curseforge": addon.Links.WebsiteUrl,
+			"project":    addon.Links.WebsiteUrl,
+		},
+		CreatedAt: addon.DateCreated,
+		Downloads: map[string]uint64{
+			"monthly": 0,
+			"total":   cast.ToUint64(addon.DownloadCount),
+		},
+		License:    "",
+		Donate:     "",
+		Categories: make([]string, 0),
+		Members:    make([]widget.ProjectMember, 0),
+		Links:      make([]string, 0),
+		Files:      make([]widget.ProjectFile, 0),
+		Versions:   widget.VersionIndex{},
+		Loaders:    map[string][]widget.ProjectFile{},
+
+		Screenshots:          make([]widget.ProjectScreenshot, 0, len(addon.Screenshots)),
+		UpdatedAt:            addon.DateModified,
+		ReleasedAt:           addon.DateReleased,
+		AllowModDistribution: addon.AllowModDistribution,
+		IsFeatured:           addon.IsFeatured,
+		Rating:               addon.Rating,
+		ClassId:              addon.ClassId,
+		MainFileId:           addon.MainFileId,
+	}
+
+	links := map[string]string{
+		"wiki":   addon.Links.WikiUrl,
+		"issues": addon.Links.IssuesUrl,
+		"source": addon.Links.SourceUrl,
+	}
+	for _, key := range []string{"wiki", "issues", "source"} {
+		if links[key] == "" {
+			continue
+		}
+		newProps.Urls[key] = links[key]
+		newProps.Links = append(newProps.Links, links[key])
+	}
+
+	for _, v := range addon.Screenshots {
+		newProps.Screenshots = append(newProps.Screenshots, widget.ProjectScreenshot{
+			Title:       v.Title,
+			Description: v.Description,
+			Thumbnail:   v.ThumbnailUrl,
+			Url:         v.Url,
+		})
+	}
+
+	for _, v := range addon.Categories {
+		newProps.Categories = append(newProps.Categories, v.Name)
+	}
+
+	categories, _ := curseforge.GetCategories(addon.GameId, ctx)
+	newProps.Type = curseforge.GetPrimaryCategoryFor(categories, addon.PrimaryCategoryId).Name
+
+	newProps.Thumbnail = addon.Logo.ThumbnailUrl
+
+	for _, v := range addon.Authors {
+		newProps.Members = append(newProps.Members, widget.ProjectMember{
+			Username: v.Name,
+			Title:    coalesce("Owner"),
+			Id:       v.Id,
+		})
+	}
+
+	return newProps
+}
+
+// setDependencyTitles names the dependencies of each file from the projects we already know about
+func setDependencyTitles(files []widget.ProjectFile, db *gorm.DB) {
+	//the same dependencies are on most files, so only ask for each once
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0)
+	for _, f := range files {
+		for _, dep := range f.Dependencies {
+			if !seen[dep.Id] {
+				seen[dep.Id] = true
+				ids = append(ids, dep.Id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	//only pull the title out, rather than loading and decoding every project
+	var rows []struct {
+		Id    uint
+		Title string
+	}
+	err := db.Model(&widget.Project{}).
+		Select("id, JSON_UNQUOTE(JSON_EXTRACT(properties, '$.title')) AS title").
+		Where("id IN ? AND JSON_VALID(properties)", ids).
+		Scan(&rows).Error
+	if err != nil {
+		log.Printf("Error getting dependency titles: %s", err)
+		return
+	}
+
+	titles := make(map[uint]string)
+	for _, v := range rows {
+		titles[v.Id] = v.Title
+	}
+
+	for i := range files {
+		for k, dep := range files[i].Dependencies {
+			files[i].Dependencies[k].Title = titles[dep.Id]
+		}
+	}
+}
+
 func getAddonProperties(id uint, ctx context.Context) (addon curseforge.Addon, err error) {
 	u := fmt.Sprintf("https://api.curseforge.com/v1/mods/%d", id)
 
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+	ThemeAuto  = "auto"
+)
+
+// cssColorRegex only allows hex colors and named colors, so a parameter can never break out of its CSS variable
+var cssColorRegex = regexp.MustCompile("^(#[0-9a-fA-F]{3,4}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{8}|[a-zA-Z]{1,32})$")
+
+// themeColorParameters maps the query parameter to the CSS variable it sets
+var themeColorParameters = map[string]string{
+	"background": "--wrapper-bg-color",
+	"text":       "--widget-text-color",
+	"link":       "--widget-link-color",
+	"button":     "--widget-button-color",
+	"accent":     "--widget-accent-color",
+}
+
+type WidgetTheme struct {
+	Name   string
+	Colors map[string]string
+}
+
+func getWidgetTheme(c *gin.Context) WidgetTheme {
+	theme := WidgetTheme{
+		Name:   ThemeLight,
+		Colors: make(map[string]string),
+	}
+
+	switch strings.ToLower(c.Query("theme")) {
+	case ThemeDark:
+		theme.Name = ThemeDark
+	case ThemeAuto:
+		theme.Name = ThemeAuto
+	}
+
+	for param, variable := range themeColorParameters {
+		if color := cssColor(c.Query(param)); color != "" {
+			theme.Colors[variable] = color
+		}
+	}
+
+	return theme
+}
+
+// Style renders the colors as CSS variables, they have been validated already so are safe to use as-is
+func (theme WidgetTheme) Style() template.CSS {
+	variables := make([]string, 0, len(theme.Colors))
+	for variable, color := range theme.Colors {
+		variables = append(variables, variable+": "+color+";")
+	}
+	sort.Strings(variables)
+	return template.CSS(strings.Join(variables, " "))
+}
+
+// cssColor returns the color if it is safe to put in a stylesheet, otherwise an empty string
+func cssColor(value string) string {
+	value = strings.TrimSpace(value)
+	if !cssColorRegex.MatchString(value) {
+		return ""
+	}
+	return value
+}
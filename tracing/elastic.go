@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.elastic.co/apm/module/apmgin/v2"
+	mysql "go.elastic.co/apm/module/apmgormv2/v2/driver/mysql"
+	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.elastic.co/apm/v2"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type elasticTracer struct{}
+
+type elasticTransaction struct {
+	trans *apm.Transaction
+}
+
+type elasticSpan struct {
+	span *apm.Span
+}
+
+func newElasticTracer() elasticTracer {
+	//there is a race condition where APM doesn't handle creating "default" right twice
+	_ = apm.DefaultTracer()
+	return elasticTracer{}
+}
+
+func (elasticTracer) startTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	trans := apm.DefaultTracer().StartTransaction(name, kind)
+	return elasticTransaction{trans: trans}, apm.ContextWithTransaction(ctx, trans)
+}
+
+func (elasticTracer) startSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	span, ctx := apm.StartSpan(ctx, name, kind)
+	return elasticSpan{span: span}, ctx
+}
+
+func (elasticTracer) setLabel(ctx context.Context, key string, value interface{}) {
+	trans := apm.TransactionFromContext(ctx)
+	if trans != nil {
+		trans.TransactionData.Context.SetLabel(key, value)
+	}
+}
+
+func (elasticTracer) middleware(engine *gin.Engine) gin.HandlerFunc {
+	return apmgin.Middleware(engine)
+}
+
+func (elasticTracer) wrapClient(client *http.Client) *http.Client {
+	return apmhttp.WrapClient(client)
+}
+
+func (elasticTracer) database(dsn string) (gorm.Dialector, gorm.Plugin) {
+	return mysql.Open(dsn), nil
+}
+
+func (elasticTracer) shutdown(context.Context) error {
+	apm.DefaultTracer().Flush(nil)
+	return nil
+}
+
+func (t elasticTransaction) End() {
+	t.trans.End()
+}
+
+func (t elasticTransaction) SetLabel(key string, value interface{}) {
+	t.trans.Context.SetLabel(key, value)
+}
+
+func (t elasticTransaction) SetFailed() {
+	t.trans.Outcome = "failure"
+}
+
+func (s elasticSpan) End() {
+	s.span.End()
+}
+
+func (s elasticSpan) SetLabel(key string, value interface{}) {
+	s.span.Context.SetLabel(key, value)
+}
+
+func (s elasticSpan) SetFailed() {
+	s.span.Outcome = "failure"
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
+	"net/http"
+)
+
+type otlpTracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+type otlpSpan struct {
+	span trace.Span
+}
+
+func newOtlpTracer() (*otlpTracer, error) {
+	ctx := context.Background()
+
+	//the exporter doesn't connect until there is something to send, so this doesn't wait on the collector
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	//OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override our own name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return &otlpTracer{provider: provider, tracer: provider.Tracer("github.com/cfwidget/cfwidget")}, nil
+}
+
+func (t *otlpTracer) startTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithNewRoot(), trace.WithAttributes(attribute.String("type", kind)))
+	return otlpSpan{span: span}, ctx
+}
+
+func (t *otlpTracer) startSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attribute.String("type", kind)))
+	return otlpSpan{span: span}, ctx
+}
+
+func (t *otlpTracer) setLabel(ctx context.Context, key string, value interface{}) {
+	trace.SpanFromContext(ctx).SetAttributes(toAttribute(key, value))
+}
+
+func (t *otlpTracer) middleware(*gin.Engine) gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName, otelgin.WithTracerProvider(t.provider))
+}
+
+func (t *otlpTracer) wrapClient(client *http.Client) *http.Client {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	wrapped := *client
+	wrapped.Transport = otelhttp.NewTransport(transport, otelhttp.WithTracerProvider(t.provider))
+	return &wrapped
+}
+
+func (t *otlpTracer) database(dsn string) (gorm.Dialector, gorm.Plugin) {
+	return mysql.Open(dsn), gormtracing.NewPlugin(gormtracing.WithTracerProvider(t.provider), gormtracing.WithoutMetrics())
+}
+
+func (t *otlpTracer) shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+func (s otlpSpan) End() {
+	s.span.End()
+}
+
+func (s otlpSpan) SetLabel(key string, value interface{}) {
+	s.span.SetAttributes(toAttribute(key, value))
+}
+
+func (s otlpSpan) SetFailed() {
+	s.span.SetStatus(codes.Error, "failure")
+}
+
+// toAttribute keeps the types APM labels allow, so labels look the same whichever tracer is used
+func toAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case uint:
+		return attribute.Int64(key, int64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+const (
+	// Elastic sends traces to Elastic APM, configured with the usual ELASTIC_APM_* variables
+	Elastic = "elastic"
+	// Otlp sends traces to an OpenTelemetry collector, configured with the usual OTEL_* variables
+	Otlp = "otlp"
+)
+
+// ServiceName is used when the tracer's own configuration doesn't name the service
+const ServiceName = "cfwidget"
+
+// Span is a transaction or span from whichever tracer is in use
+type Span interface {
+	End()
+	SetLabel(key string, value interface{})
+	// SetFailed marks the outcome as a failure
+	SetFailed()
+}
+
+type tracer interface {
+	startTransaction(ctx context.Context, name, kind string) (Span, context.Context)
+	startSpan(ctx context.Context, name, kind string) (Span, context.Context)
+	setLabel(ctx context.Context, key string, value interface{})
+	middleware(engine *gin.Engine) gin.HandlerFunc
+	wrapClient(client *http.Client) *http.Client
+	database(dsn string) (gorm.Dialector, gorm.Plugin)
+	shutdown(ctx context.Context) error
+}
+
+// the tracer is picked as the package loads, as other packages wrap their clients in their own init
+var current = newTracer(env.GetOr("TRACING", Elastic))
+
+func newTracer(name string) tracer {
+	switch name {
+	case Elastic:
+		return newElasticTracer()
+	case Otlp:
+		t, err := newOtlpTracer()
+		if err != nil {
+			panic(err)
+		}
+		return t
+	default:
+		panic(fmt.Errorf("unknown TRACING %s, expected %s or %s", name, Elastic, Otlp))
+	}
+}
+
+// StartTransaction starts a new trace, for work which isn't part of a request such as scheduled syncs
+func StartTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	return current.startTransaction(ctx, name, kind)
+}
+
+// StartSpan starts a span under whatever is already in the context
+func StartSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	return current.startSpan(ctx, name, kind)
+}
+
+// SetLabel labels the request or transaction the context belongs to
+func SetLabel(ctx context.Context, key string, value interface{}) {
+	current.setLabel(ctx, key, value)
+}
+
+// Middleware traces each request gin handles
+func Middleware(engine *gin.Engine) gin.HandlerFunc {
+	return current.middleware(engine)
+}
+
+// WrapClient traces the calls made with the client
+func WrapClient(client *http.Client) *http.Client {
+	return current.wrapClient(client)
+}
+
+// OpenDatabase gives the MySQL dialector for the dsn, along with a plugin to register when the tracer needs one
+func OpenDatabase(dsn string) (gorm.Dialector, gorm.Plugin) {
+	return current.database(dsn)
+}
+
+// Shutdown sends anything which hasn't been sent yet
+func Shutdown(ctx context.Context) error {
+	return current.shutdown(ctx)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/widget"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const V2Path = "v2/"
+
+// The v2 responses are kept apart from what we store, so the stored data can change without breaking clients
+
+type V2Response struct {
+	Data interface{} `json:"data" openapi:"required"`
+}
+
+type V2ErrorResponse struct {
+	Error V2Error `json:"error" openapi:"required"`
+}
+
+type V2Error struct {
+	Status  int    `json:"status" openapi:"required"`
+	Code    string `json:"code" openapi:"required"`
+	Message string `json:"message" openapi:"required"`
+}
+
+type V2Project struct {
+	Id                   uint              `json:"id"`
+	Title                string            `json:"title"`
+	Summary              string            `json:"summary"`
+	Description          string            `json:"description"`
+	Game                 string            `json:"game"`
+	ClassId              uint              `json:"class_id"`
+	Class                string            `json:"class"`
+	Categories           []string          `json:"categories"`
+	Urls                 map[string]string `json:"urls"`
+	Thumbnail            string            `json:"thumbnail"`
+	Screenshots          []V2Screenshot    `json:"screenshots"`
+	Members              []V2Member        `json:"members"`
+	TotalDownloads       uint64            `json:"total_downloads"`
+	Rating               float64           `json:"rating"`
+	IsFeatured           bool              `json:"is_featured"`
+	AllowModDistribution *bool             `json:"allow_mod_distribution"`
+	GameVersions         []string          `json:"game_versions"`
+	Loaders              []string          `json:"loaders"`
+	MainFileId           uint              `json:"main_file_id"`
+	Download             *V2File           `json:"download"`
+	Files                []V2File          `json:"files"`
+	CreatedAt            time.Time         `json:"created_at"`
+	UpdatedAt            time.Time         `json:"updated_at"`
+	ReleasedAt           time.Time         `json:"released_at"`
+}
+
+type V2Screenshot struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Thumbnail   string `json:"thumbnail"`
+	Url         string `json:"url"`
+}
+
+type V2Member struct {
+	Id       uint   `json:"id"`
+	Username string `json:"username"`
+	Title    string `json:"title"`
+}
+
+type V2File struct {
+	Id           uint           `json:"id"`
+	Name         string         `json:"name"`
+	DisplayName  string         `json:"display_name"`
+	ReleaseType  string         `json:"release_type"`
+	Url          string         `json:"url"`
+	DownloadUrl  string         `json:"download_url"`
+	FileSize     uint64         `json:"file_size"`
+	Downloads    uint           `json:"downloads"`
+	GameVersions []string       `json:"game_versions"`
+	Loaders      []string       `json:"loaders"`
+	Dependencies []V2Dependency `json:"dependencies"`
+	UploadedAt   time.Time      `json:"uploaded_at"`
+}
+
+type V2Dependency struct {
+	ProjectId uint   `json:"project_id"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+}
+
+type V2Author struct {
+	Id       uint              `json:"id" openapi:"required"`
+	Username string            `json:"username" openapi:"required"`
+	Projects []V2AuthorProject `json:"projects" openapi:"required"`
+}
+
+type V2AuthorProject struct {
+	Id    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+// GetV2 handles everything under /v2/ on the API host
+func GetV2(c *gin.Context, path string) {
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	switch {
+	case strings.HasPrefix(path, "projects/"):
+		project, status, err := resolveProject(strings.TrimPrefix(path, "projects/"), ctx)
+		if err != nil {
+			v2Fail(c, status, err)
+			return
+		}
+		if project == nil || project.ParsedProjects == nil {
+			v2Error(c, http.StatusNotFound, "project not found")
+			return
+		}
+
+		properties := project.ParsedProjects
+		response := newV2Project(properties, selectDownload(properties, c.Query("version"), c.Query("loader")))
+		v2Respond(c, getFieldSelection(c).apply(response))
+	case strings.HasPrefix(path, "authors/"):
+		author, status, err := resolveAuthor(strings.TrimPrefix(path, "authors/"), ctx)
+		if err != nil {
+			v2Fail(c, status, err)
+			return
+		}
+		if author == nil {
+			v2Error(c, http.StatusNotFound, "author not found")
+			return
+		}
+
+		v2Respond(c, newV2Author(author))
+	default:
+		v2Error(c, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+func v2Respond(c *gin.Context, data interface{}) {
+	response := V2Response{Data: data}
+	cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "application/json", response)
+	cacheHeaders(c, cacheExpireTime)
+	c.JSON(http.StatusOK, response)
+	c.Abort()
+}
+
+// v2Error responds with the error envelope, the code is the status text so clients don't need to know the numbers
+func v2Error(c *gin.Context, status int, message string) {
+	response := V2ErrorResponse{Error: V2Error{
+		Status:  status,
+		Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		Message: message,
+	}}
+
+	//not found is worth caching, anything else may work on the next try
+	if status == http.StatusNotFound {
+		SetInCache(c.Request.Host, cacheKey(c), status, "application/json", response)
+	}
+	c.AbortWithStatusJSON(status, response)
+}
+
+// v2Fail responds with the error, telling the client when to try again when they've been rate limited
+func v2Fail(c *gin.Context, status int, err error) {
+	var rateLimitErr RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		setRetryAfter(c, rateLimitErr.RetryAfter)
+		status = http.StatusTooManyRequests
+	}
+	v2Error(c, status, err.Error())
+}
+
+func newV2Project(properties *widget.ProjectProperties, download *widget.ProjectFile) V2Project {
+	project := V2Project{
+		Id:                   properties.Id,
+		Title:                properties.Title,
+		Summary:              properties.Summary,
+		Description:          properties.Description,
+		Game:                 properties.Game,
+		ClassId:              properties.ClassId,
+		Class:                properties.Type,
+		Categories:           properties.Categories,
+		Urls:                 properties.Urls,
+		Thumbnail:            properties.Thumbnail,
+		Screenshots:          make([]V2Screenshot, 0, len(properties.Screenshots)),
+		Members:              make([]V2Member, 0, len(properties.Members)),
+		TotalDownloads:       properties.Downloads["total"],
+		Rating:               properties.Rating,
+		IsFeatured:           properties.IsFeatured,
+		AllowModDistribution: properties.AllowModDistribution,
+		GameVersions:         properties.Versions.Keys(),
+		Loaders:              make([]string, 0, len(properties.Loaders)),
+		MainFileId:           properties.MainFileId,
+		Files:                make([]V2File, 0, len(properties.Files)),
+		CreatedAt:            properties.CreatedAt,
+		UpdatedAt:            properties.UpdatedAt,
+		ReleasedAt:           properties.ReleasedAt,
+	}
+
+	if project.Categories == nil {
+		project.Categories = make([]string, 0)
+	}
+	if project.Urls == nil {
+		project.Urls = make(map[string]string)
+	}
+
+	for _, v := range properties.Screenshots {
+		project.Screenshots = append(project.Screenshots, V2Screenshot(v))
+	}
+	for _, v := range properties.Members {
+		project.Members = append(project.Members, V2Member{Id: v.Id, Username: v.Username, Title: v.Title})
+	}
+	for k := range properties.Loaders {
+		project.Loaders = append(project.Loaders, k)
+	}
+	sort.Strings(project.Loaders)
+	for _, v := range properties.Files {
+		project.Files = append(project.Files, newV2File(v))
+	}
+
+	if download != nil {
+		file := newV2File(*download)
+		project.Download = &file
+	}
+
+	return project
+}
+
+func newV2File(file widget.ProjectFile) V2File {
+	result := V2File{
+		Id:           file.Id,
+		Name:         file.Name,
+		DisplayName:  file.Display,
+		ReleaseType:  file.Type,
+		Url:          file.Url,
+		DownloadUrl:  file.DownloadUrl,
+		FileSize:     file.FileSize,
+		Downloads:    file.Downloads,
+		GameVersions: fileGameVersions(file),
+		Loaders:      file.Loaders,
+		Dependencies: make([]V2Dependency, 0, len(file.Dependencies)),
+		UploadedAt:   file.UploadedAt,
+	}
+
+	if result.GameVersions == nil {
+		result.GameVersions = make([]string, 0)
+	}
+	if result.Loaders == nil {
+		result.Loaders = make([]string, 0)
+	}
+
+	for _, v := range file.Dependencies {
+		result.Dependencies = append(result.Dependencies, V2Dependency{ProjectId: v.Id, Title: v.Title, Type: v.Type})
+	}
+
+	return result
+}
+
+func newV2Author(author *widget.Author) V2Author {
+	result := V2Author{
+		Id:       author.MemberId,
+		Username: author.Username,
+		Projects: make([]V2AuthorProject, 0, len(author.ParsedProjects.Projects)),
+	}
+
+	for _, v := range author.ParsedProjects.Projects {
+		result.Projects = append(result.Projects, V2AuthorProject{Id: v.Id, Title: v.Name})
+	}
+
+	return result
+}
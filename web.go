@@ -2,20 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
 	"github.com/cfwidget/cfwidget/env"
+	"github.com/cfwidget/cfwidget/metrics"
+	"github.com/cfwidget/cfwidget/tracing"
 	"github.com/cfwidget/cfwidget/widget"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
-	"go.elastic.co/apm/v2"
-	"golang.org/x/text/language"
-	"golang.org/x/text/message"
 	"gorm.io/gorm"
 	"html/template"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
@@ -27,8 +28,10 @@ type ApiWebResponse struct {
 
 const AuthorPath = "author/"
 
+// LatestVersionRequest asks for the file supporting the highest game version, rather than the most recent upload
+const LatestVersionRequest = "latest"
+
 var templateEngine *template.Template
-var messagePrinter = message.NewPrinter(language.English)
 
 //go:embed favicon.ico
 var faviconFile []byte
@@ -41,21 +44,26 @@ var templates embed.FS
 
 func RegisterApiRoutes(e *gin.Engine) {
 	var err error
-	templateEngine, err = template.New("").ParseFS(templates, "templates/*.tmpl")
+	templateEngine, err = template.New("").Funcs(template.FuncMap{
+		"fileSize": formatFileSize,
+	}).ParseFS(templates, "templates/*.tmpl")
 	if err != nil {
 		panic(err)
 	}
 
 	e.SetHTMLTemplate(templateEngine)
 
-	e.GET("/*projectPath", setTransaction, readFromCache, Resolve, GetAuthor, GetProject)
-	e.DELETE("/*projectPath", setTransaction, deleteFromCache)
-	e.POST("/:id", SyncCall)
+	e.GET("/*projectPath", setTransaction, authenticate, readFromCache, rateLimit, Resolve, GetAuthor, GetProject)
+	e.DELETE("/*projectPath", setTransaction, DeleteCall)
+	e.POST("/batch", setTransaction, authenticate, rateLimit, BatchCall)
+	e.POST("/manifest", setTransaction, authenticate, rateLimit, ManifestCall)
+	e.POST("/"+AdminKeysPath, setTransaction, requireAdmin(ScopeKeys), CreateApiKey)
+	e.POST("/:id", requireAdmin(ScopeSync), SyncCall)
 }
 
 func Resolve(c *gin.Context) {
 	path := strings.TrimSuffix(strings.TrimPrefix(c.Param("projectPath"), "/"), ".json")
-	path = strings.TrimSuffix(path, ".png")
+	path, _, _ = splitImageExtension(path)
 
 	if path == "" {
 		//if this is not the web side of the fence, redirect to the web side of the fence
@@ -92,8 +100,45 @@ func Resolve(c *gin.Context) {
 		return
 	}
 
+	if path == OpenApiPath {
+		GetOpenApi(c)
+		return
+	}
+
+	if path == MetricsPath {
+		GetMetrics(c)
+		return
+	}
+
+	if path == AdminKeysPath || strings.HasPrefix(path, AdminKeysPath+"/") {
+		GetApiKeys(c, strings.TrimPrefix(strings.TrimPrefix(path, AdminKeysPath), "/"))
+		return
+	}
+
+	if strings.HasPrefix(path, V2Path) {
+		GetV2(c, strings.TrimPrefix(path, V2Path))
+		return
+	}
+
+	if path == CollectionPath {
+		GetCollection(c)
+		return
+	}
+
+	if path == SearchPath {
+		GetSearch(c)
+		return
+	}
+
+	if isGamesPath(path) {
+		GetGames(c)
+		return
+	}
+
 	if strings.HasPrefix(path, AuthorPath) {
 		handleResolveAuthor(c, strings.TrimPrefix(path, AuthorPath))
+	} else if project, resource := splitProjectResource(path); resource != "" {
+		handleProjectResource(c, project, resource)
 	} else {
 		handleResolveProject(c, path)
 	}
@@ -108,39 +153,12 @@ func GetProject(c *gin.Context) {
 	project := obj.(*widget.Project)
 	properties := project.ParsedProjects
 
-	versionRequest := c.Query("version")
-	loader := c.Query("loader")
-
-	var latest widget.ProjectFile
-	for _, v := range properties.Files {
-		if v.UploadedAt.After(latest.UploadedAt) {
-			if !loaderMatches(loader, v.Versions) {
-				continue
-			}
-			if versionRequest == "" {
-				latest = v
-			} else if versionRequest == cast.ToString(v.Id) {
-				latest = v
-			} else if versionRequest == v.Type {
-				latest = v
-			} else {
-				if contains(versionRequest, v.Versions) {
-					latest = v
-				}
-				for _, y := range v.Versions {
-					if versionRequest == fmt.Sprintf("%s/%s", y, v.Type) {
-						latest = v
-						break
-					}
-				}
-			}
+	if properties != nil {
+		if latest := selectDownload(properties, c.Query("version"), c.Query("loader")); latest != nil {
+			properties.Download = latest
 		}
 	}
 
-	if latest.Id != 0 {
-		properties.Download = &latest
-	}
-
 	if c.Request.Host == env.Get("API_HOSTNAME") {
 		status := project.Status
 
@@ -153,21 +171,18 @@ func GetProject(c *gin.Context) {
 			}
 		}
 
-		cacheExpireTime := SetInCache(c.Request.Host, c.Request.URL.RequestURI(), status, "application/json", properties)
+		var response interface{} = properties
+		if properties != nil {
+			response = getFieldSelection(c).apply(properties)
+		}
+
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), status, "application/json", response)
 		cacheHeaders(c, cacheExpireTime)
-		c.JSON(status, properties)
+		c.JSON(status, response)
 	} else {
 		path := strings.TrimSuffix(strings.TrimPrefix(c.Param("projectPath"), "/"), ".json")
-		if strings.HasSuffix(path, ".png") {
-			_, dark := c.GetQuery("dark")
-			_, transparent := c.GetQuery("transparent")
-			_, nuThumb := c.GetQuery("noThumbnail")
-
-			imageRequest := ImageRequest{
-				DarkMode:    dark,
-				Transparent: transparent,
-				NoThumbnail: nuThumb,
-			}
+		if _, format, isImage := splitImageExtension(path); isImage {
+			imageRequest := newImageRequest(c, format)
 
 			data, err := generateImage(properties, imageRequest, c.Request.Context())
 			if err != nil {
@@ -176,31 +191,31 @@ func GetProject(c *gin.Context) {
 				return
 			}
 
-			cacheExpireTime := SetInCache(c.Request.Host, c.Request.URL.RequestURI(), http.StatusOK, "image/png", data)
+			contentType := imageContentTypes[imageRequest.Format]
+			cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, contentType, data)
 			cacheHeaders(c, cacheExpireTime)
 
-			c.Data(http.StatusOK, "image/png", data)
+			c.Data(http.StatusOK, contentType, data)
 		} else {
-			downloads := messagePrinter.Sprintf("%d\n", properties.Downloads["total"])
-
-			var borderClass string
-			switch c.Query("border") {
-			case "none":
-				borderClass = "border-none"
-			default:
-				borderClass = "border-default"
+			localizer := NewLocalizer(requestLanguage(c))
+
+			var changelog template.HTML
+			if c.Query("changelog") == "1" {
+				changelog = template.HTML(getWidgetChangelog(c, properties))
 			}
 
 			buf := &bytes.Buffer{}
 			_ = templateEngine.ExecuteTemplate(buf, "widget.tmpl", gin.H{
 				"project":       properties,
-				"downloadCount": downloads,
-				"background":    c.DefaultQuery("background", "#fff"),
-				"borderClass":   borderClass,
+				"downloadCount": localizer.Number(properties.Downloads["total"]),
+				"theme":         getWidgetTheme(c),
+				"borderClass":   getBorderClass(c),
+				"i18n":          localizer,
+				"changelog":     changelog,
 			})
 			data := buf.Bytes()
 
-			cacheExpireTime := SetInCache(c.Request.Host, c.Request.URL.RequestURI(), http.StatusOK, "text/html", data)
+			cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "text/html", data)
 			cacheHeaders(c, cacheExpireTime)
 			c.Data(http.StatusOK, "text/html", data)
 		}
@@ -215,16 +230,68 @@ func GetAuthor(c *gin.Context) {
 	}
 
 	author := obj.(*widget.Author)
-	response := widget.AuthorResponse{
-		Id:       author.MemberId,
-		Username: author.Username,
-		Projects: author.ParsedProjects.Projects,
+
+	if c.Request.Host == env.Get("API_HOSTNAME") {
+		response := widget.AuthorResponse{
+			Id:       author.MemberId,
+			Username: author.Username,
+			Projects: author.ParsedProjects.Projects,
+		}
+
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), 200, "application/json", response)
+		cacheHeaders(c, cacheExpireTime)
+
+		c.JSON(http.StatusOK, response)
+		c.Abort()
+		return
 	}
 
-	cacheExpireTime := SetInCache(c.Request.Host, c.Request.URL.RequestURI(), 200, "application/json", response)
-	cacheHeaders(c, cacheExpireTime)
+	projects, err := loadAuthorProjects(author, c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return
+	}
+
+	var downloads uint64
+	for _, v := range projects {
+		downloads += v.Downloads["total"]
+	}
+
+	path := strings.TrimPrefix(c.Param("projectPath"), "/")
+	if _, format, isImage := splitImageExtension(path); isImage {
+		imageRequest := newImageRequest(c, format)
+
+		data, err := generateAuthorImage(author, projects, downloads, imageRequest, c.Request.Context())
+		if err != nil {
+			log.Print(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		contentType := imageContentTypes[imageRequest.Format]
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, contentType, data)
+		cacheHeaders(c, cacheExpireTime)
 
-	c.JSON(http.StatusOK, response)
+		c.Data(http.StatusOK, contentType, data)
+	} else {
+		localizer := NewLocalizer(requestLanguage(c))
+
+		buf := &bytes.Buffer{}
+		_ = templateEngine.ExecuteTemplate(buf, "author.tmpl", gin.H{
+			"author":        author,
+			"projects":      projects,
+			"downloadCount": localizer.Number(downloads),
+			"theme":         getWidgetTheme(c),
+			"borderClass":   getBorderClass(c),
+			"i18n":          localizer,
+		})
+		data := buf.Bytes()
+
+		cacheExpireTime := SetInCache(c.Request.Host, cacheKey(c), http.StatusOK, "text/html", data)
+		cacheHeaders(c, cacheExpireTime)
+		c.Data(http.StatusOK, "text/html", data)
+	}
+	c.Abort()
 }
 
 func SyncCall(c *gin.Context) {
@@ -234,91 +301,144 @@ func SyncCall(c *gin.Context) {
 }
 
 func handleResolveProject(c *gin.Context, path string) {
-	db, err := GetDatabase()
+	project, status, err := resolveProject(path, c.Request.Context())
+	var rateLimitErr RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		abortRateLimited(c, rateLimitErr.RetryAfter)
+		return
+	}
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		c.AbortWithStatusJSON(status, ApiWebResponse{Error: err.Error()})
 		return
 	}
-
-	ctx := c.Request.Context()
-
-	db = db.WithContext(ctx)
-
-	if strings.HasPrefix(path, "mc-mods/minecraft/") {
-		path = "minecraft/mc-mods/" + strings.TrimPrefix(path, "mc-mods/minecraft/")
+	if project == nil {
+		c.AbortWithStatus(status)
+		return
 	}
 
-	lookup := &widget.ProjectLookup{Path: path}
+	c.Set("project", project)
+}
 
-	if id, err := cast.ToUintE(path); err == nil {
-		//the url is actually the id, so can provide the JSON directly
-		//this also fixes the author endpoint when you query with that ID
-		lookup.CurseId = &id
-	} else {
-		//the path given is just a path, we need to resolve it to a project
-		err = db.Where(lookup).First(&lookup).Error
+// resolveProject finds the project for a path or id, syncing it when it's unknown or stale.
+// A nil project is returned with the status to respond with when it can't be used.
+func resolveProject(path string, ctx context.Context) (*widget.Project, int, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			lookup.CurseId = addProjectConsumer.Consume(path, ctx)
-			err = db.Save(&lookup).Error
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
-			}
-		} else if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
-			return
-		}
+	db = db.WithContext(ctx)
 
-		if lookup.CurseId == nil {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
+	curseId, err := resolveProjectId(path, ctx)
+	if errors.As(err, &RateLimitError{}) {
+		return nil, http.StatusTooManyRequests, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if curseId == nil {
+		return nil, http.StatusNotFound, nil
 	}
 
 	project := &widget.Project{
-		CurseId: *lookup.CurseId,
+		CurseId: *curseId,
 	}
 	err = db.First(&project).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) || project.ParsedProjects == nil || project.UpdatedAt.Before(time.Now().Add(-1*time.Hour)) {
-		update, err := SyncProject(project.CurseId, ctx)
-		if err == nil {
-			project = update
+		if limitErr := allowUpstream(ctx); limitErr != nil {
+			//stale data is still better than making them wait
+			if project.ParsedProjects == nil {
+				return nil, http.StatusTooManyRequests, limitErr
+			}
+		} else {
+			update, err := SyncProject(project.CurseId, ctx)
+			if err == nil {
+				project = update
+			}
 		}
 	} else if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
-		return
+		return nil, http.StatusInternalServerError, err
 	}
 
 	if project == nil || project.CurseId == 0 {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
+		return nil, http.StatusNotFound, nil
 	}
 
 	switch project.Status {
 	case 404:
-		{
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
+		return nil, http.StatusNotFound, nil
 	case 403:
 		fallthrough
 	case 200:
-		c.Set("project", project)
+		return project, http.StatusOK, nil
 	default:
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: fmt.Sprintf("project status is unknown (%d)", project.Status)})
+		return nil, http.StatusInternalServerError, fmt.Errorf("project status is unknown (%d)", project.Status)
 	}
 }
 
-func handleResolveAuthor(c *gin.Context, path string) {
-	ctx := c.Request.Context()
+// resolveProjectId turns a path into the CurseForge id, returning nil when no project lives at the path
+func resolveProjectId(path string, ctx context.Context) (*uint, error) {
+	if strings.HasPrefix(path, "mc-mods/minecraft/") {
+		path = "minecraft/mc-mods/" + strings.TrimPrefix(path, "mc-mods/minecraft/")
+	}
+
+	lookup := &widget.ProjectLookup{Path: path}
+
+	if id, err := cast.ToUintE(path); err == nil {
+		//the url is actually the id, so can provide the JSON directly
+		//this also fixes the author endpoint when you query with that ID
+		return &id, nil
+	}
 
 	db, err := GetDatabase()
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
+		return nil, err
+	}
+
+	db = db.WithContext(ctx)
+
+	//the path given is just a path, we need to resolve it to a project
+	err = db.Where(lookup).First(&lookup).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err = allowUpstream(ctx); err != nil {
+			return nil, err
+		}
+		lookup.CurseId = addProjectConsumer.Consume(path, ctx)
+		err = db.Save(&lookup).Error
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return lookup.CurseId, nil
+}
+
+func handleResolveAuthor(c *gin.Context, path string) {
+	author, status, err := resolveAuthor(path, c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(status, ApiWebResponse{Error: err.Error()})
+		return
+	}
+	if author == nil {
+		c.AbortWithStatus(status)
 		return
 	}
 
+	c.Set("author", author)
+}
+
+// resolveAuthor finds the author by id or by search/{username}, syncing them when stale.
+// A nil author is returned with the status to respond with when it can't be found.
+func resolveAuthor(path string, ctx context.Context) (*widget.Author, int, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
 	db = db.WithContext(ctx)
 
 	author := &widget.Author{}
@@ -330,15 +450,15 @@ func handleResolveAuthor(c *gin.Context, path string) {
 		var id uint
 		id, err = cast.ToUintE(path)
 		if err != nil {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
+			return nil, http.StatusNotFound, nil
 		}
 		err = db.Where("member_id = ?", id).First(&author).Error
 	}
 
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, ApiWebResponse{Error: err.Error()})
-		return
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, http.StatusNotFound, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
 
 	if author.UpdatedAt.Before(time.Now().Add(-1 * time.Hour)) {
@@ -348,14 +468,218 @@ func handleResolveAuthor(c *gin.Context, path string) {
 		}
 	}
 
-	c.Set("author", author)
+	return author, http.StatusOK, nil
+}
+
+// loadAuthorProjects gets the synced data for the author's projects, most recently updated first
+func loadAuthorProjects(author *widget.Author, ctx context.Context) ([]*widget.ProjectProperties, error) {
+	projects := make([]*widget.ProjectProperties, 0)
+
+	ids := make([]uint, 0)
+	for _, v := range author.ParsedProjects.Projects {
+		ids = append(ids, v.Id)
+	}
+	if len(ids) == 0 {
+		return projects, nil
+	}
+
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*widget.Project
+	err = db.WithContext(ctx).Where("id IN ?", ids).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range rows {
+		if v.ParsedProjects == nil {
+			continue
+		}
+		v.ParsedProjects.Download = selectDownload(v.ParsedProjects, "", "")
+		projects = append(projects, v.ParsedProjects)
+	}
+
+	sort.SliceStable(projects, func(i, j int) bool {
+		return lastUploadedAt(projects[i]).After(lastUploadedAt(projects[j]))
+	})
+
+	return projects, nil
+}
+
+func lastUploadedAt(properties *widget.ProjectProperties) time.Time {
+	if properties.Download == nil {
+		return properties.CreatedAt
+	}
+	return properties.Download.UploadedAt
 }
 
-func loaderMatches(loader string, versions []string) bool {
+func newImageRequest(c *gin.Context, format string) ImageRequest {
+	if format == "" {
+		format = negotiateImageFormat(c.GetHeader("Accept"))
+	}
+
+	_, dark := c.GetQuery("dark")
+	_, transparent := c.GetQuery("transparent")
+	_, nuThumb := c.GetQuery("noThumbnail")
+
+	return ImageRequest{
+		DarkMode:    dark,
+		Transparent: transparent,
+		NoThumbnail: nuThumb,
+		Format:      format,
+		Quality:     cast.ToInt(c.Query("quality")),
+		Localizer:   NewLocalizer(requestLanguage(c)),
+	}
+}
+
+func getBorderClass(c *gin.Context) string {
+	switch c.Query("border") {
+	case "none":
+		return "border-none"
+	default:
+		return "border-default"
+	}
+}
+
+// selectDownload finds the most recent file matching the version and loader requested, or nil if none do
+func selectDownload(properties *widget.ProjectProperties, versionRequest, loader string) *widget.ProjectFile {
+	if versionRequest == LatestVersionRequest {
+		return selectLatestGameVersion(properties, loader)
+	}
+
+	versionRange, isRange := widget.ParseVersionRange(versionRequest)
+
+	var latest widget.ProjectFile
+	for _, v := range loaderFiles(properties, loader) {
+		if v.UploadedAt.After(latest.UploadedAt) {
+			if !loaderMatches(loader, v) {
+				continue
+			}
+			if versionRequest == "" {
+				latest = v
+			} else if versionRequest == cast.ToString(v.Id) {
+				latest = v
+			} else if versionRequest == v.Type {
+				latest = v
+			} else if isRange {
+				if versionRange.MatchesAny(fileGameVersions(v)) {
+					latest = v
+				}
+			} else {
+				if contains(versionRequest, v.Versions) {
+					latest = v
+				}
+				for _, y := range v.Versions {
+					if versionRequest == fmt.Sprintf("%s/%s", y, v.Type) {
+						latest = v
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if latest.Id == 0 {
+		return nil
+	}
+	return &latest
+}
+
+// selectLatestGameVersion finds the file for the highest game version, with the most recent upload winning ties
+func selectLatestGameVersion(properties *widget.ProjectProperties, loader string) *widget.ProjectFile {
+	var latest *widget.ProjectFile
+	var latestVersion widget.GameVersion
+	for _, v := range loaderFiles(properties, loader) {
+		if !loaderMatches(loader, v) {
+			continue
+		}
+
+		for _, g := range fileGameVersions(v) {
+			version := widget.ParseGameVersion(g)
+			if !version.Valid {
+				continue
+			}
+
+			result := 1
+			if latest != nil {
+				result = version.Compare(latestVersion)
+			}
+			if result > 0 || (result == 0 && v.UploadedAt.After(latest.UploadedAt)) {
+				file := v
+				latest = &file
+				latestVersion = version
+			}
+		}
+	}
+	return latest
+}
+
+// fileGameVersions gives the game versions of the file, falling back to everything listed for files synced before
+// loaders were split out
+func fileGameVersions(file widget.ProjectFile) []string {
+	if file.GameVersions != nil {
+		return file.GameVersions
+	}
+	return file.Versions
+}
+
+// loaderFiles uses the loader index to narrow down the files, when the project has been synced with one
+func loaderFiles(properties *widget.ProjectProperties, loader string) []widget.ProjectFile {
+	if loader == "" || properties.Loaders == nil {
+		return properties.Files
+	}
+
+	for name, files := range properties.Loaders {
+		if strings.EqualFold(name, loader) {
+			return files
+		}
+	}
+	return nil
+}
+
+func loaderMatches(loader string, file widget.ProjectFile) bool {
 	if loader == "" {
 		return true
 	}
-	return contains(loader, versions)
+	//files from before loaders were split out only have them mixed in with the versions
+	if file.Loaders == nil {
+		return contains(loader, file.Versions)
+	}
+	return contains(loader, file.Loaders)
+}
+
+// cacheKey is the request URI, plus anything else the response varies on
+func cacheKey(c *gin.Context) string {
+	key := c.Request.URL.RequestURI()
+	//the response is the same whatever key was used, so don't keep a copy for each key
+	if query := c.Request.URL.Query(); query.Has("key") {
+		query.Del("key")
+		u := *c.Request.URL
+		u.RawQuery = query.Encode()
+		key = u.RequestURI()
+	}
+	if c.Request.Host != env.Get("API_HOSTNAME") {
+		key += "#" + requestLanguage(c).String()
+	}
+	if strings.HasSuffix(c.Request.URL.Path, NegotiatedImageExtension) {
+		key += "#" + negotiateImageFormat(c.GetHeader("Accept"))
+	}
+	return key
+}
+
+// varyHeaders tells downstream caches about the headers cacheKey takes into account
+func varyHeaders(c *gin.Context) {
+	if c.Request.Host == env.Get("API_HOSTNAME") {
+		return
+	}
+	if strings.HasSuffix(c.Request.URL.Path, NegotiatedImageExtension) {
+		c.Header("Vary", "Accept, Accept-Language")
+	} else {
+		c.Header("Vary", "Accept-Language")
+	}
 }
 
 func cacheHeaders(c *gin.Context, cacheExpireTime time.Time) {
@@ -365,18 +689,16 @@ func cacheHeaders(c *gin.Context, cacheExpireTime time.Time) {
 	c.Header("Cache-Control", fmt.Sprintf("max-age=%.0f, public", maxAge))
 	c.Header("Age", fmt.Sprintf("%.0f", age))
 	c.Header("MemCache-Expires-At", cacheExpireTime.UTC().Format(time.RFC3339))
+	varyHeaders(c)
 }
 
 func readFromCache(c *gin.Context) {
-	trans := apm.TransactionFromContext(c.Request.Context())
-
-	cacheData, exists := GetFromCache(c.Request.Host, c.Request.URL.RequestURI())
+	cacheData, exists := GetFromCache(c.Request.Host, cacheKey(c))
 	if exists {
 		cacheHeaders(c, cacheData.ExpireAt)
 
-		if trans != nil {
-			trans.TransactionData.Context.SetLabel("cached", true)
-		}
+		tracing.SetLabel(c.Request.Context(), "cached", true)
+		metrics.ObserveCache(true)
 
 		if cacheData.ContentType == "application/json" {
 			c.JSON(cacheData.Status, cacheData.Data)
@@ -389,22 +711,40 @@ func readFromCache(c *gin.Context) {
 
 		c.Abort()
 	} else {
-		if trans != nil {
-			trans.TransactionData.Context.SetLabel("cached", false)
-		}
+		tracing.SetLabel(c.Request.Context(), "cached", false)
+		metrics.ObserveCache(false)
 	}
 }
 
 func setTransaction(c *gin.Context) {
-	trans := apm.TransactionFromContext(c.Request.Context())
-	if trans != nil {
-		for k, v := range c.Request.URL.Query() {
-			trans.TransactionData.Context.SetLabel(k, strings.ToLower(strings.Join(v, ",")))
+	ctx := c.Request.Context()
+	for k, v := range c.Request.URL.Query() {
+		//never send API keys along with the trace
+		if k == "key" {
+			continue
 		}
+		tracing.SetLabel(ctx, k, strings.ToLower(strings.Join(v, ",")))
+	}
+
+	for _, v := range c.Params {
+		tracing.SetLabel(ctx, v.Key, v.Value)
+	}
+}
 
-		for _, v := range c.Params {
-			trans.TransactionData.Context.SetLabel(v.Key, v.Value)
+// DeleteCall revokes API keys under admin/keys, and purges anything else from the cache
+func DeleteCall(c *gin.Context) {
+	path := strings.TrimPrefix(c.Param("projectPath"), "/")
+	if id, found := strings.CutPrefix(path, AdminKeysPath+"/"); found {
+		requireAdmin(ScopeKeys)(c)
+		if !c.IsAborted() {
+			RevokeApiKey(c, id)
 		}
+		return
+	}
+
+	requireAdmin(ScopeCache)(c)
+	if !c.IsAborted() {
+		deleteFromCache(c)
 	}
 }
 
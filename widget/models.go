@@ -64,8 +64,25 @@ type ProjectProperties struct {
 	Members     []ProjectMember          `json:"members"`
 	Links       []string                 `json:"links"`
 	Files       []ProjectFile            `json:"files"`
-	Versions    map[string][]ProjectFile `json:"versions"`
+	Versions    VersionIndex             `json:"versions"`
+	Loaders     map[string][]ProjectFile `json:"loaders"`
 	Download    *ProjectFile             `json:"download,omitempty"`
+
+	Screenshots          []ProjectScreenshot `json:"screenshots"`
+	UpdatedAt            time.Time           `json:"updated_at"`
+	ReleasedAt           time.Time           `json:"released_at"`
+	AllowModDistribution *bool               `json:"allow_mod_distribution"`
+	IsFeatured           bool                `json:"is_featured"`
+	Rating               float64             `json:"rating"`
+	ClassId              uint                `json:"class_id"`
+	MainFileId           uint                `json:"main_file_id"`
+}
+
+type ProjectScreenshot struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Thumbnail   string `json:"thumbnail"`
+	Url         string `json:"url"`
 }
 
 type ProjectMember struct {
@@ -75,16 +92,46 @@ type ProjectMember struct {
 }
 
 type ProjectFile struct {
-	Id         uint      `json:"id"`
-	Url        string    `json:"url"`
-	Display    string    `json:"display"`
-	Name       string    `json:"name"`
-	Type       string    `json:"type"`
-	Version    string    `json:"version"`
-	FileSize   uint64    `json:"filesize"`
-	Versions   []string  `json:"versions"`
-	Downloads  uint      `json:"downloads"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	Id           uint             `json:"id"`
+	Url          string           `json:"url"`
+	Display      string           `json:"display"`
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	Version      string           `json:"version"`
+	FileSize     uint64           `json:"filesize"`
+	Versions     []string         `json:"versions"`
+	Downloads    uint             `json:"downloads"`
+	UploadedAt   time.Time        `json:"uploaded_at"`
+	DownloadUrl  string           `json:"download_url,omitempty"`
+	Dependencies []FileDependency `json:"dependencies"`
+	Loaders      []string         `json:"loaders"`
+	GameVersions []string         `json:"game_versions"`
+}
+
+type FileDependency struct {
+	Id    uint   `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title,omitempty"`
+}
+
+// ApiKey is a key we've issued to a consumer, only the hash of the key itself is kept
+type ApiKey struct {
+	Id                uint `gorm:"primaryKey"`
+	Name              string
+	KeyHash           string `gorm:"type:CHAR(64);uniqueIndex"`
+	Prefix            string `gorm:"type:VARCHAR(16)"`
+	RequestsPerMinute int
+	DailyQuota        int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	RevokedAt         *time.Time `gorm:"index"`
+}
+
+// ApiKeyUsage counts the requests made with a key each day (UTC)
+type ApiKeyUsage struct {
+	ApiKeyId uint      `gorm:"primaryKey;autoIncrement:false"`
+	Day      time.Time `gorm:"primaryKey;type:DATE"`
+	Requests uint64
 }
 
 type Author struct {
@@ -123,7 +170,7 @@ type AuthorProject struct {
 }
 
 type AuthorResponse struct {
-	Id       uint            `json:"id"`
-	Username string          `json:"username"`
+	Id       uint            `json:"id" openapi:"required"`
+	Username string          `json:"username" openapi:"required"`
 	Projects []AuthorProject `json:"projects"`
 }
@@ -0,0 +1,257 @@
+package widget
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionIndex is the files for each game version, which is written out in version order rather than by name
+type VersionIndex map[string][]ProjectFile
+
+// GameVersion is a dotted version such as 1.20.1, with anything after a - (such as -pre1 or -Snapshot) kept as the
+// pre-release. Versions which don't start with a number, such as the 23w13a snapshots, are not valid and sort first.
+type GameVersion struct {
+	Raw        string
+	Parts      []int
+	PreRelease string
+	Valid      bool
+}
+
+type versionConstraint struct {
+	operator string
+	version  GameVersion
+	//wildcard is how many parts must match, when the version ended in .x or .*
+	wildcard int
+}
+
+// VersionRange is a set of constraints which must all match, such as ">=1.19 <1.21", "1.20.x" or "1.20.*"
+type VersionRange struct {
+	constraints []versionConstraint
+}
+
+func ParseGameVersion(raw string) GameVersion {
+	version := GameVersion{Raw: raw}
+
+	main := raw
+	if i := strings.Index(raw, "-"); i >= 0 {
+		main, version.PreRelease = raw[:i], raw[i+1:]
+	}
+
+	for _, v := range strings.Split(main, ".") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return GameVersion{Raw: raw}
+		}
+		version.Parts = append(version.Parts, n)
+	}
+
+	version.Valid = true
+	return version
+}
+
+// Compare gives -1, 0 or 1 as this version is before, the same as or after the other
+func (v GameVersion) Compare(other GameVersion) int {
+	if v.Valid != other.Valid {
+		if v.Valid {
+			return 1
+		}
+		return -1
+	}
+	if !v.Valid {
+		return strings.Compare(v.Raw, other.Raw)
+	}
+
+	for i := 0; i < len(v.Parts) || i < len(other.Parts); i++ {
+		a, b := partOrZero(v.Parts, i), partOrZero(other.Parts, i)
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	//a pre-release comes before the release itself
+	if v.PreRelease == "" || other.PreRelease == "" {
+		if v.PreRelease == other.PreRelease {
+			return 0
+		}
+		if v.PreRelease == "" {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(strings.ToLower(v.PreRelease), strings.ToLower(other.PreRelease))
+}
+
+func CompareGameVersions(a, b string) int {
+	return ParseGameVersion(a).Compare(ParseGameVersion(b))
+}
+
+// ParseVersionRange parses the request as a range, returning false when it's just a version to match exactly
+func ParseVersionRange(request string) (VersionRange, bool) {
+	var versionRange VersionRange
+	isRange := false
+
+	for _, v := range strings.FieldsFunc(request, func(r rune) bool { return r == ',' || r == ' ' }) {
+		constraint := versionConstraint{operator: "="}
+		for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(v, op) {
+				constraint.operator = op
+				v = strings.TrimPrefix(v, op)
+				isRange = true
+				break
+			}
+		}
+
+		parts := strings.Split(v, ".")
+		if last := parts[len(parts)-1]; len(parts) > 1 && (last == "x" || last == "X" || last == "*") {
+			constraint.wildcard = len(parts) - 1
+			v = strings.Join(parts[:len(parts)-1], ".")
+			isRange = true
+		}
+
+		constraint.version = ParseGameVersion(v)
+		if !constraint.version.Valid || (constraint.wildcard > 0 && constraint.version.PreRelease != "") {
+			return VersionRange{}, false
+		}
+
+		//1.20.x starts at 1.20, so these are the same as comparing with that
+		if constraint.operator == ">=" || constraint.operator == "<" {
+			constraint.wildcard = 0
+		}
+
+		versionRange.constraints = append(versionRange.constraints, constraint)
+	}
+
+	if len(versionRange.constraints) > 1 {
+		isRange = true
+	}
+
+	return versionRange, isRange && len(versionRange.constraints) > 0
+}
+
+func (r VersionRange) Matches(raw string) bool {
+	version := ParseGameVersion(raw)
+	if !version.Valid {
+		return false
+	}
+
+	for _, c := range r.constraints {
+		if c.wildcard > 0 {
+			//compare only the parts before the wildcard, anything after 1.20.x comes after all of it
+			result := 0
+			for i := 0; i < c.wildcard && result == 0; i++ {
+				a, b := partOrZero(version.Parts, i), partOrZero(c.version.Parts, i)
+				if a < b {
+					result = -1
+				} else if a > b {
+					result = 1
+				}
+			}
+
+			var matches bool
+			switch c.operator {
+			case ">":
+				matches = result > 0
+			case "<=":
+				matches = result <= 0
+			default:
+				//pre-releases aren't part of the release they come before
+				matches = result == 0 && version.PreRelease == ""
+				if c.operator == "!=" {
+					matches = !matches
+				}
+			}
+			if !matches {
+				return false
+			}
+			continue
+		}
+
+		result := version.Compare(c.version)
+		var matches bool
+		switch c.operator {
+		case ">=":
+			matches = result >= 0
+		case "<=":
+			matches = result <= 0
+		case ">":
+			matches = result > 0
+		case "<":
+			matches = result < 0
+		case "!=":
+			matches = result != 0
+		default:
+			matches = result == 0
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchesAny checks if any of the versions are in the range
+func (r VersionRange) MatchesAny(versions []string) bool {
+	for _, v := range versions {
+		if r.Matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys gives the versions in order, oldest first
+func (index VersionIndex) Keys() []string {
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		result := CompareGameVersions(keys[i], keys[j])
+		if result == 0 {
+			return keys[i] < keys[j]
+		}
+		return result < 0
+	})
+	return keys
+}
+
+func (index VersionIndex) MarshalJSON() ([]byte, error) {
+	if index == nil {
+		return []byte("null"), nil
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range index.Keys() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(index[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func partOrZero(parts []int, i int) int {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package widget
+
+import (
+	"testing"
+)
+
+func TestCompareGameVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.20", "1.20", 0},
+		{"1.20", "1.20.0", 0},
+		{"1.20.0.0", "1.20", 0},
+		{"1.20.1", "1.20", 1},
+		{"1.20", "1.20.1", -1},
+		{"1.9", "1.10", -1},
+		{"1.19.4", "1.20", -1},
+		{"2", "1.99.99", 1},
+		{"1.20-pre1", "1.20", -1},
+		{"1.20-pre1", "1.19.4", 1},
+		{"1.20-pre1", "1.20-pre2", -1},
+		{"1.20-rc1", "1.20-pre2", 1},
+		{"1.20-Pre1", "1.20-pre1", 0},
+		{"1.20.1-rc1", "1.20", 1},
+		{"23w13a", "1.0", -1},
+		{"23w13a", "23w14a", -1},
+		{"23w13a", "23w13a", 0},
+	}
+
+	for _, test := range tests {
+		if result := CompareGameVersions(test.a, test.b); result != test.expected {
+			t.Errorf("expected %s compared to %s to be %d, got %d", test.a, test.b, test.expected, result)
+		}
+		if result := CompareGameVersions(test.b, test.a); result != -test.expected {
+			t.Errorf("expected %s compared to %s to be %d, got %d", test.b, test.a, -test.expected, result)
+		}
+	}
+}
+
+func TestParseGameVersion(t *testing.T) {
+	tests := []struct {
+		raw        string
+		valid      bool
+		parts      int
+		preRelease string
+	}{
+		{"1.20.1", true, 3, ""},
+		{"1.20-pre1", true, 2, "pre1"},
+		{"1.20.1-rc1", true, 3, "rc1"},
+		{"1.20-Snapshot", true, 2, "Snapshot"},
+		{"23w13a", false, 0, ""},
+		{"Forge", false, 0, ""},
+		{"1..2", false, 0, ""},
+		{"1.-2", false, 0, ""},
+		{"", false, 0, ""},
+	}
+
+	for _, test := range tests {
+		version := ParseGameVersion(test.raw)
+		if version.Valid != test.valid || len(version.Parts) != test.parts || version.PreRelease != test.preRelease {
+			t.Errorf("unexpected parse of %q: %+v", test.raw, version)
+		}
+	}
+}
+
+func TestVersionRangeMatches(t *testing.T) {
+	tests := []struct {
+		request    string
+		matches    []string
+		notMatches []string
+	}{
+		{"1.20.x", []string{"1.20", "1.20.0", "1.20.1", "1.20.6"}, []string{"1.19.4", "1.21", "1.20-pre1", "1.20.1-rc1", "23w13a"}},
+		{"1.20.*", []string{"1.20", "1.20.4"}, []string{"1.2", "1.21.1", "1.20.2-pre1"}},
+		{"1.X", []string{"1.7.10", "1.20.1"}, []string{"2.0"}},
+		{"!=1.20.x", []string{"1.19.4", "1.21"}, []string{"1.20", "1.20.1"}},
+		{">=1.19", []string{"1.19", "1.19.0", "1.19.4", "1.20.1", "2"}, []string{"1.18.2", "1.19-pre1", "23w13a"}},
+		{">1.19", []string{"1.19.1", "1.20"}, []string{"1.19", "1.19.0", "1.18"}},
+		{"<=1.19", []string{"1.19", "1.18.2", "1.19-pre1"}, []string{"1.19.1"}},
+		{"<1.19", []string{"1.18.2", "1.19-pre1"}, []string{"1.19", "1.20"}},
+		{"=1.19.2", []string{"1.19.2"}, []string{"1.19.3", "1.19"}},
+		{"!=1.19.2", []string{"1.19.3", "1.19"}, []string{"1.19.2"}},
+		{">=1.19 <1.21", []string{"1.19", "1.20.4"}, []string{"1.18.2", "1.21"}},
+		{">=1.19,<1.21", []string{"1.19", "1.20.4"}, []string{"1.18.2", "1.21"}},
+		{">=1.19, <1.21, !=1.20.1", []string{"1.19", "1.20", "1.20.2"}, []string{"1.20.1", "1.21"}},
+		{">=1.16.x,<1.20.x", []string{"1.16", "1.16.5", "1.19.4"}, []string{"1.15.2", "1.20", "1.20.1"}},
+		{">=1.20.x", []string{"1.20", "1.20.1", "1.21", "2.0"}, []string{"1.19.4", "1.20-pre1"}},
+		{"<1.20.x", []string{"1.19.4", "1.20-pre1", "1.7.10"}, []string{"1.20", "1.20.1", "1.21"}},
+		{">1.20.x", []string{"1.21", "1.21-pre1", "2.0"}, []string{"1.20", "1.20.6", "1.19"}},
+		{"<=1.20.x", []string{"1.19.4", "1.20", "1.20.6"}, []string{"1.21", "1.21-pre1"}},
+	}
+
+	for _, test := range tests {
+		versionRange, ok := ParseVersionRange(test.request)
+		if !ok {
+			t.Errorf("expected %q to be a range", test.request)
+			continue
+		}
+		for _, v := range test.matches {
+			if !versionRange.Matches(v) {
+				t.Errorf("expected %q to match %s", test.request, v)
+			}
+		}
+		for _, v := range test.notMatches {
+			if versionRange.Matches(v) {
+				t.Errorf("expected %q not to match %s", test.request, v)
+			}
+		}
+	}
+}
+
+func TestParseVersionRangeRejects(t *testing.T) {
+	//plain versions are matched exactly rather than as a range, and anything we can't make sense of isn't a range
+	for _, request := range []string{"", "1.20", "1.20.1", "latest", "release", "Forge", "23w13a", ">=23w13a", ">=", "1.20 Forge", ">=1.19,abc", "1.20-pre1.x", "x", ",,"} {
+		if _, ok := ParseVersionRange(request); ok {
+			t.Errorf("expected %q not to be a range", request)
+		}
+	}
+}
+
+func TestVersionRangeMatchesAny(t *testing.T) {
+	versionRange, ok := ParseVersionRange("1.20.x")
+	if !ok {
+		t.Fatal("expected 1.20.x to be a range")
+	}
+	if !versionRange.MatchesAny([]string{"Forge", "1.19.4", "1.20.1"}) {
+		t.Error("expected a match on 1.20.1")
+	}
+	if versionRange.MatchesAny([]string{"Forge", "Fabric", "1.19.4"}) {
+		t.Error("expected no match without a 1.20 version")
+	}
+}
+
+func TestVersionIndexKeys(t *testing.T) {
+	index := VersionIndex{"1.20.1": nil, "1.9": nil, "1.20": nil, "1.10.2": nil, "23w13a": nil, "1.20-pre1": nil}
+	expected := []string{"23w13a", "1.9", "1.10.2", "1.20-pre1", "1.20", "1.20.1"}
+
+	keys := index.Keys()
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, keys)
+		}
+	}
+}